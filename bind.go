@@ -0,0 +1,122 @@
+package v8
+
+// #include "v8wrap.h"
+import "C"
+
+import (
+	"fmt"
+	"reflect"
+)
+
+var valueType = reflect.TypeOf((*Value)(nil))
+
+// Bind registers fn as a global JS function named name.  fn may be any Go
+// function: its arguments are converted from JS like Value.Decode does and
+// its result is converted back, e.g.
+//
+//	ctx.Bind("area", func(w, h int) int { return w * h })
+//
+// Arguments that cannot be converted throw a TypeError-like error naming the
+// argument ("argument 2: expected number, got string").  Missing arguments
+// are treated as undefined, and extra arguments are ignored.  Parameters of
+// type *Value receive the argument unconverted.
+//
+// fn may return nothing, a value, an error, or a value and an error.  A
+// non-nil error is thrown in JS.
+func (v *V8Context) Bind(name string, fn interface{}) error {
+	f, err := v.boundFunction(name, fn)
+	if err != nil {
+		return err
+	}
+	return v.addGlobalFunction(name, f)
+}
+
+func (v *V8Context) boundFunction(name string, fn interface{}) (hostFunc, error) {
+	fv := reflect.ValueOf(fn)
+	if fv.Kind() != reflect.Func || fv.IsNil() {
+		return nil, fmt.Errorf("Cannot bind %s: %T is not a function", name, fn)
+	}
+	ft := fv.Type()
+	switch {
+	case ft.NumOut() > 2,
+		ft.NumOut() == 2 && ft.Out(1) != errorType:
+		return nil, fmt.Errorf("Cannot bind %s: %v must return at most a value and an error", name, ft)
+	}
+
+	return func(this *Value, args []*Value, construct bool) (*Value, error) {
+		// Arguments are released once converted, except those handed to fn
+		// as *Values.
+		defer v.releaseValues(this)
+		for i, arg := range args {
+			if paramType(ft, i) != valueType {
+				defer v.releaseValues(arg)
+			}
+		}
+		in, err := v.bindArgs(ft, args)
+		if err != nil {
+			return nil, err
+		}
+
+		out := fv.Call(in)
+		if n := len(out); n > 0 && ft.Out(n-1) == errorType {
+			if !out[n-1].IsNil() {
+				return nil, out[n-1].Interface().(error)
+			}
+			out = out[:n-1]
+		}
+		if len(out) == 0 {
+			return nil, nil
+		}
+		if out[0].Type() == valueType {
+			return out[0].Interface().(*Value), nil
+		}
+		res, err := v.ToValue(out[0].Interface())
+		if err != nil {
+			return nil, err
+		}
+		return v.releaseLater(res), nil
+	}, nil
+}
+
+// paramType returns the type of the parameter of ft receiving argument i, or
+// nil if the argument is ignored.
+func paramType(ft reflect.Type, i int) reflect.Type {
+	switch n := ft.NumIn(); {
+	case ft.IsVariadic() && i >= n-1:
+		return ft.In(n - 1).Elem()
+	case i < n:
+		return ft.In(i)
+	}
+	return nil
+}
+
+// bindArgs converts args to the parameters of a function of type ft.
+func (v *V8Context) bindArgs(ft reflect.Type, args []*Value) ([]reflect.Value, error) {
+	var in []reflect.Value
+	n := ft.NumIn()
+	if ft.IsVariadic() {
+		n--
+	}
+	for i := 0; i < n; i++ {
+		var arg *Value
+		if i < len(args) {
+			arg = args[i]
+		}
+		val, err := v.fromJS(arg, ft.In(i))
+		if err != nil {
+			return nil, fmt.Errorf("argument %d: %v", i+1, err)
+		}
+		in = append(in, val)
+	}
+	if ft.IsVariadic() {
+		elem := ft.In(n).Elem()
+		for i := n; i < len(args); i++ {
+			val, err := v.fromJS(args[i], elem)
+			if err != nil {
+				return nil, fmt.Errorf("argument %d: %v", i+1, err)
+			}
+			in = append(in, val)
+		}
+	}
+	return in, nil
+}
@@ -0,0 +1,20 @@
+//go:build go1.18
+// +build go1.18
+
+package v8
+
+// Func1 binds f as a global JS function named name, like Bind, but with the
+// signature of f checked at compile time.
+func Func1[A, R any](ctx *V8Context, name string, f func(A) (R, error)) error {
+	return ctx.Bind(name, f)
+}
+
+// Func2 is Func1 for functions of two arguments.
+func Func2[A, B, R any](ctx *V8Context, name string, f func(A, B) (R, error)) error {
+	return ctx.Bind(name, f)
+}
+
+// Func3 is Func1 for functions of three arguments.
+func Func3[A, B, C, R any](ctx *V8Context, name string, f func(A, B, C) (R, error)) error {
+	return ctx.Bind(name, f)
+}
@@ -0,0 +1,22 @@
+//go:build go1.18
+// +build go1.18
+
+package v8
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFunc2(t *testing.T) {
+	ctx := NewContext()
+	err := Func2(ctx, "repeat", func(s string, n int) (string, error) {
+		return strings.Repeat(s, n), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res, err := ctx.Eval(`repeat("ab", 3)`, NO_FILE); err != nil || res != "ababab" {
+		t.Errorf("Expected ababab, got %v (err: %v)", res, err)
+	}
+}
@@ -0,0 +1,93 @@
+package v8
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type bindPoint struct {
+	X, Y int
+}
+
+func TestBind(t *testing.T) {
+	ctx := NewContext()
+	err := ctx.Bind("describe", func(name string, n int, points []bindPoint, scale *float64) (map[string]interface{}, error) {
+		sum := 0
+		for _, p := range points {
+			sum += p.X + p.Y
+		}
+		res := map[string]interface{}{"name": name, "total": sum * n}
+		if scale != nil {
+			res["scaled"] = float64(sum) * *scale
+		}
+		return res, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := ctx.Eval(`describe("pts", 2, [{X:1, Y:2}, {X:3, Y:4}], 0.5)`, NO_FILE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{"name": "pts", "total": 20.0, "scaled": 5.0}
+	if !reflect.DeepEqual(res, expected) {
+		t.Errorf("Expected %v, got %v", expected, res)
+	}
+}
+
+func TestBindArgumentErrors(t *testing.T) {
+	ctx := NewContext()
+	ctx.Bind("f", func(s string, n int8, b bool, xs []int) {})
+
+	for js, msg := range map[string]string{
+		`f("a", "b", true, [])`: "argument 2: expected number, got string",
+		`f("a", 1.5, true, [])`: "argument 2: expected integer, got 1.5",
+		`f("a", 300, true, [])`: "argument 2: 300 overflows int8",
+		`f(1, 1, true, [])`:     "argument 1: expected string, got number",
+		`f("a", 1, null, [])`:   "argument 3: expected boolean, got null",
+		`f("a", 1, true, {})`:   "argument 4: expected array, got object",
+		`f("a", 1, true, 5)`:    "argument 4: expected array, got number",
+		`f("a", 1)`:             "argument 3: expected boolean, got undefined",
+	} {
+		_, err := ctx.Eval(js, NO_FILE)
+		if err == nil || !strings.Contains(err.Error(), msg) {
+			t.Errorf("%s: expected an error containing %q, got %v", js, msg, err)
+		}
+	}
+}
+
+func TestBindResults(t *testing.T) {
+	ctx := NewContext()
+	ctx.Bind("none", func() {})
+	ctx.Bind("fail", func() error { return errors.New("failed") })
+	ctx.Bind("raw", func(v *Value) *Value { return v })
+	ctx.Bind("sum", func(xs ...float64) (float64, error) {
+		total := 0.0
+		for _, x := range xs {
+			total += x
+		}
+		return total, nil
+	})
+
+	if res, err := ctx.Eval(`[typeof none(), raw("x"), sum(1, 2, 3)]`, NO_FILE); err != nil {
+		t.Fatal(err)
+	} else if expected := []interface{}{"undefined", "x", 6.0}; !reflect.DeepEqual(res, expected) {
+		t.Errorf("Expected %v, got %v", expected, res)
+	}
+	if _, err := ctx.Eval(`fail()`, NO_FILE); err == nil || !strings.Contains(err.Error(), "failed") {
+		t.Errorf("Expected the error to be thrown, got %v", err)
+	}
+}
+
+func TestBindRejectsNonFunctions(t *testing.T) {
+	ctx := NewContext()
+	if err := ctx.Bind("f", 3); err == nil {
+		t.Error("Expected an error binding a non-function")
+	}
+	if err := ctx.Bind("f", func() (int, int) { return 0, 0 }); err == nil {
+		t.Error("Expected an error binding a function with two non-error results")
+	}
+}
@@ -0,0 +1,252 @@
+package v8
+
+// #include <stdlib.h>
+// #include "v8wrap.h"
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"runtime"
+	"time"
+	"unsafe"
+)
+
+// MapEntry is an entry of a JS Map.
+type MapEntry struct {
+	Key, Value *Value
+}
+
+// The flags of V8's RegExp::Flags, by letter.
+var regExpFlags = map[rune]C.int{
+	'g': 1 << 0,
+	'i': 1 << 1,
+	'm': 1 << 2,
+	'y': 1 << 3,
+	'u': 1 << 4,
+	's': 1 << 5,
+}
+
+// is reports whether v holds a JS value of the given kind.
+func (v *Value) is(kind C.ValueKind) bool {
+	if v == nil || v.ctx == nil {
+		return false
+	}
+	var res bool
+	v.ctx.exec(func() {
+		res = v.check() == nil && v.ctx.kind(v) == kind
+	})
+	return res
+}
+
+// IsDate reports whether v holds a JS Date.
+func (v *Value) IsDate() bool { return v.is(C.VALUE_DATE) }
+
+// IsMap reports whether v holds a JS Map.
+func (v *Value) IsMap() bool { return v.is(C.VALUE_MAP) }
+
+// IsSet reports whether v holds a JS Set.
+func (v *Value) IsSet() bool { return v.is(C.VALUE_SET) }
+
+// IsBigInt reports whether v holds a JS BigInt.
+func (v *Value) IsBigInt() bool { return v.is(C.VALUE_BIGINT) }
+
+// IsRegExp reports whether v holds a JS RegExp.
+func (v *Value) IsRegExp() bool { return v.is(C.VALUE_REGEXP) }
+
+// withKind runs f inside exec if v holds a JS value of the given kind, and
+// returns an error otherwise.  v is kept alive until f returns, so that f may
+// pass v.ptr to C.
+func (v *Value) withKind(kind C.ValueKind, f func() error) error {
+	if v == nil {
+		return ErrNilValue
+	}
+	if v.ctx == nil {
+		return ErrContextDestroyed
+	}
+	var err error
+	v.ctx.exec(func() {
+		if err = v.check(); err != nil {
+			return
+		}
+		if actual := v.ctx.kind(v); actual != kind {
+			err = fmt.Errorf("Value is not a %s but a %s", kindNames[kind], kindNames[actual])
+			return
+		}
+		err = f()
+		runtime.KeepAlive(v)
+	})
+	return err
+}
+
+// ToTime converts a value holding a JS Date to a time.Time, without going
+// through a string.  The result is in UTC.
+func (v *Value) ToTime() (time.Time, error) {
+	var res time.Time
+	err := v.withKind(C.VALUE_DATE, func() error {
+		ms := float64(C.v8_value_number(v.ctx.v8context, v.ptr))
+		if math.IsNaN(ms) {
+			return errors.New("Cannot convert an Invalid Date to a time")
+		}
+		res = msToTime(ms).UTC()
+		return nil
+	})
+	return res, err
+}
+
+// NewDate returns a JS Date for t.  JS Dates have millisecond precision.
+func (v *V8Context) NewDate(t time.Time) (*Value, error) {
+	return v.ToValue(t)
+}
+
+// MapEntries returns the entries of a value holding a JS Map, in insertion
+// order.
+func (v *Value) MapEntries() ([]MapEntry, error) {
+	var res []MapEntry
+	err := v.withKind(C.VALUE_MAP, func() error {
+		items, err := v.ctx.arrayItems(C.v8_map_entries(v.ctx.v8context, v.ptr))
+		for i := 0; i+1 < len(items); i += 2 {
+			res = append(res, MapEntry{items[i], items[i+1]})
+		}
+		return err
+	})
+	return res, err
+}
+
+// NewMap returns a JS Map holding the given entries.
+func (v *V8Context) NewMap(entries ...MapEntry) (*Value, error) {
+	var res *Value
+	var err error
+	v.exec(func() {
+		if v.v8context == nil {
+			err = ErrContextDestroyed
+			return
+		}
+		for _, entry := range entries {
+			if err = entry.Key.checkIn(v); err != nil {
+				return
+			}
+			if err = entry.Value.checkIn(v); err != nil {
+				return
+			}
+		}
+		m := v.newValue(C.v8_new_map(v.v8context))
+		for _, entry := range entries {
+			errmsg := C.v8_map_set(v.v8context, m.ptr, entry.Key.ptr, entry.Value.ptr)
+			runtime.KeepAlive(entry)
+			if errmsg != nil {
+				v.releaseValues(m)
+				err = errors.New(C.GoString(errmsg))
+				return
+			}
+		}
+		res = m
+	})
+	return res, err
+}
+
+// SetValues returns the values of a value holding a JS Set, in insertion
+// order.
+func (v *Value) SetValues() ([]*Value, error) {
+	var res []*Value
+	err := v.withKind(C.VALUE_SET, func() error {
+		var err error
+		res, err = v.ctx.arrayItems(C.v8_set_values(v.ctx.v8context, v.ptr))
+		return err
+	})
+	return res, err
+}
+
+// arrayItems returns the elements of the array ptr, which it releases.  It
+// must be called inside exec.
+func (v *V8Context) arrayItems(ptr C.PersistentValuePtr) ([]*Value, error) {
+	arr := v.newValue(ptr)
+	defer v.releaseValues(arr)
+	d := v.newDecoder()
+	items, err := d.elements(arr, "")
+	if err != nil {
+		d.release()
+		return nil, err
+	}
+	// Release the other properties that came along with the elements.
+	for _, item := range items {
+		d.kept[item] = true
+	}
+	d.release()
+	return items, nil
+}
+
+// ToBigInt converts a value holding a JS BigInt to a big.Int.
+func (v *Value) ToBigInt() (*big.Int, error) {
+	var res *big.Int
+	err := v.withKind(C.VALUE_BIGINT, func() error {
+		res = v.ctx.bigInt(v)
+		return nil
+	})
+	return res, err
+}
+
+// bigInt converts val, which must hold a BigInt.  It must be called inside
+// exec.
+func (v *V8Context) bigInt(val *Value) *big.Int {
+	var sign, count C.int
+	var words *C.uint64_t
+	ok := C.v8_bigint_words(v.v8context, val.ptr, &sign, &count, &words)
+	runtime.KeepAlive(val)
+	if !ok {
+		return nil
+	}
+	defer C.free(unsafe.Pointer(words))
+
+	res := new(big.Int)
+	word := new(big.Int)
+	magnitude := (*[1 << 24]C.uint64_t)(unsafe.Pointer(words))[:count:count]
+	for i := len(magnitude) - 1; i >= 0; i-- {
+		res.Lsh(res, 64).Or(res, word.SetUint64(uint64(magnitude[i])))
+	}
+	if sign != 0 {
+		res.Neg(res)
+	}
+	return res
+}
+
+// NewBigInt returns a JS BigInt for n.  It fails if the version of V8 does
+// not support BigInts.
+func (v *V8Context) NewBigInt(n *big.Int) (*Value, error) {
+	if n == nil {
+		return nil, errors.New("Cannot create a BigInt from a nil *big.Int")
+	}
+	return v.ToValue(n)
+}
+
+// NewRegExp returns a JS RegExp like new RegExp(pattern, flags) would.
+func (v *V8Context) NewRegExp(pattern, flags string) (*Value, error) {
+	var cflags C.int
+	for _, flag := range flags {
+		bit, ok := regExpFlags[flag]
+		if !ok || cflags&bit != 0 {
+			return nil, fmt.Errorf("Invalid regular expression flags '%s'", flags)
+		}
+		cflags |= bit
+	}
+	cpattern := newCString(pattern)
+	defer freeCString(cpattern)
+
+	var res *Value
+	var err error
+	v.exec(func() {
+		if v.v8context == nil {
+			err = ErrContextDestroyed
+			return
+		}
+		ptr := C.v8_new_regexp(v.v8context, cpattern, cflags)
+		if ptr == nil {
+			err = errors.New(takeCString(C.v8_error(v.v8context)))
+			return
+		}
+		res = v.newValue(ptr)
+	})
+	return res, err
+}
@@ -0,0 +1,172 @@
+package v8
+
+import (
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDates(t *testing.T) {
+	ctx := NewContext()
+	date := evalOrFatal(t, ctx, `new Date(Date.UTC(2021, 2, 28, 1, 30, 0, 250))`)
+	if !date.IsDate() || date.IsMap() {
+		t.Error("Expected a Date")
+	}
+	tm, err := date.ToTime()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := time.Date(2021, 3, 28, 1, 30, 0, 250e6, time.UTC); !tm.Equal(expected) {
+		t.Errorf("Expected %v, got %v", expected, tm)
+	}
+
+	// Time zones don't matter: the instant is what crosses over.
+	loc := time.FixedZone("UTC-7", -7*3600)
+	val, err := ctx.NewDate(time.Date(2021, 3, 27, 18, 30, 0, 0, loc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	iso, err := ctx.Apply(evalOrFatal(t, ctx, `(function(d) { return d.toISOString(); })`), nil, val)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if str := toJsonOrFatal(iso, t); str != `"2021-03-28T01:30:00.000Z"` {
+		t.Errorf("Unexpected date: %s", str)
+	}
+
+	if _, err := evalOrFatal(t, ctx, `"2021-03-28"`).ToTime(); err == nil {
+		t.Error("Expected an error converting a string to a time")
+	}
+
+	invalid := evalOrFatal(t, ctx, `new Date(NaN)`)
+	if _, err := invalid.ToTime(); err == nil || !strings.Contains(err.Error(), "Invalid Date") {
+		t.Errorf("Expected an error converting an Invalid Date, got %v", err)
+	}
+	var decoded time.Time
+	if err := invalid.Decode(&decoded); err == nil || err.Error() != "invalid date" {
+		t.Errorf("Expected an error decoding an Invalid Date, got %v", err)
+	}
+}
+
+func TestMapsAndSets(t *testing.T) {
+	ctx := NewContext()
+	m := evalOrFatal(t, ctx, `new Map([["a", 1], [2, {b: true}]])`)
+	if !m.IsMap() {
+		t.Error("Expected a Map")
+	}
+	entries, err := m.MapEntries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 entries, got %d", len(entries))
+	}
+	if k, v := toJsonOrFatal(entries[1].Key, t), toJsonOrFatal(entries[1].Value, t); k != "2" || v != `{"b":true}` {
+		t.Errorf("Unexpected entry %s => %s", k, v)
+	}
+
+	key, _ := ctx.ToValue(map[string]int{"k": 1})
+	value, _ := ctx.ToValue("v")
+	created, err := ctx.NewMap(MapEntry{key, value})
+	if err != nil {
+		t.Fatal(err)
+	}
+	get := evalOrFatal(t, ctx, `(function(m, k) { return m.get(k); })`)
+	if res, err := ctx.Apply(get, nil, created, key); err != nil {
+		t.Fatal(err)
+	} else if str := toJsonOrFatal(res, t); str != `"v"` {
+		t.Errorf("Expected objects to work as keys, got %s", str)
+	}
+
+	set := evalOrFatal(t, ctx, `new Set(["x", "y", "x"])`)
+	if !set.IsSet() {
+		t.Error("Expected a Set")
+	}
+	values, err := set.SetValues()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var strs []string
+	for _, val := range values {
+		strs = append(strs, toJsonOrFatal(val, t))
+	}
+	if !reflect.DeepEqual(strs, []string{`"x"`, `"y"`}) {
+		t.Errorf("Unexpected values: %v", strs)
+	}
+	if err := set.Decode(&strs); err != nil || !reflect.DeepEqual(strs, []string{"x", "y"}) {
+		t.Errorf("Expected the Set to decode as a slice, got %v, %v", strs, err)
+	}
+
+	// Inherited properties that aren't elements are released.
+	for _, val := range values {
+		ctx.ReleaseValue(val)
+	}
+	evalOrFatal(t, ctx, `Array.prototype.extra = 1`)
+	before := liveValues(ctx)
+	if values, err = set.SetValues(); err != nil {
+		t.Fatal(err)
+	}
+	if live := liveValues(ctx); live != before+len(values) {
+		t.Errorf("Expected %d live values, got %d", before+len(values), live)
+	}
+}
+
+func TestBigInts(t *testing.T) {
+	ctx := NewContext()
+	n, _ := new(big.Int).SetString("-98765432109876543210987654321", 10)
+	val, err := ctx.NewBigInt(n)
+	if err != nil && err.Error() == errBigIntUnsupported.Error() {
+		t.Skip(err)
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	if !val.IsBigInt() {
+		t.Error("Expected a BigInt")
+	}
+	res, err := ctx.Apply(evalOrFatal(t, ctx, `(function(n) { return n * 2n; })`), nil, val)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doubled, err := res.ToBigInt()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := new(big.Int).Mul(n, big.NewInt(2)); doubled.Cmp(expected) != 0 {
+		t.Errorf("Expected %v, got %v", expected, doubled)
+	}
+
+	var decoded struct{ N *big.Int }
+	if err := evalOrFatal(t, ctx, `({N: 2n ** 70n})`).Decode(&decoded); err != nil {
+		t.Fatal(err)
+	}
+	if expected := new(big.Int).Lsh(big.NewInt(1), 70); decoded.N.Cmp(expected) != 0 {
+		t.Errorf("Expected %v, got %v", expected, decoded.N)
+	}
+}
+
+func TestRegExps(t *testing.T) {
+	ctx := NewContext()
+	re, err := ctx.NewRegExp(`^a+(\d)$`, "gi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !re.IsRegExp() {
+		t.Error("Expected a RegExp")
+	}
+	res, err := ctx.Apply(evalOrFatal(t, ctx, `(function(re) { return [re.flags, "AA7".replace(re, "$1")]; })`), nil, re)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if str := toJsonOrFatal(res, t); str != `["gi","7"]` {
+		t.Errorf("Unexpected result: %s", str)
+	}
+
+	if _, err := ctx.NewRegExp("a", "gx"); err == nil || !strings.Contains(err.Error(), "flags") {
+		t.Errorf("Expected an error for invalid flags, got %v", err)
+	}
+	if _, err := ctx.NewRegExp("(", ""); err == nil {
+		t.Error("Expected an error for an invalid pattern")
+	}
+}
@@ -0,0 +1,166 @@
+package v8
+
+// #include "v8wrap.h"
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+)
+
+// NotCallableError is returned when calling a value that is not a function.
+type NotCallableError struct {
+	// Kind is the kind of the value, such as "object" or "undefined".
+	Kind string
+	// Method is the name of the method for CallMethod, empty otherwise.
+	Method string
+}
+
+func (e *NotCallableError) Error() string {
+	if e.Method != "" {
+		return fmt.Sprintf("Method %s is not a function but a %s", e.Method, e.Kind)
+	}
+	return fmt.Sprintf("Value is not a function but a %s", e.Kind)
+}
+
+// Call calls the function held by v with the given this and arguments.  If
+// this is nil, the function is called in the global scope.  this and the
+// arguments may be *Values or Go values, which are converted with ToValue.
+func (v *Value) Call(this interface{}, args ...interface{}) (*Value, error) {
+	if v == nil {
+		return nil, ErrNilValue
+	}
+	if v.ctx == nil {
+		return nil, ErrContextDestroyed
+	}
+	ctx := v.ctx
+	var res *Value
+	var err error
+	ctx.exec(func() {
+		if ctx.v8context == nil {
+			err = ErrContextDestroyed
+			return
+		}
+		var self *Value
+		if this != nil {
+			if self, err = ctx.toJS(this); err != nil {
+				err = fmt.Errorf("this: %v", err)
+				return
+			}
+			defer ctx.releaseValues(self)
+		}
+		var argv []*Value
+		if argv, err = ctx.toJSArgs(args); err != nil {
+			return
+		}
+		defer ctx.releaseValues(argv...)
+		res, err = ctx.Apply(v, self, argv...)
+	})
+	return res, err
+}
+
+// New calls the constructor held by v with the given arguments, like the new
+// operator.  The arguments may be *Values or Go values, which are converted
+// with ToValue.
+func (v *Value) New(args ...interface{}) (*Value, error) {
+	if v == nil {
+		return nil, ErrNilValue
+	}
+	if v.ctx == nil {
+		return nil, ErrContextDestroyed
+	}
+	ctx := v.ctx
+	var res *Value
+	var err error
+	ctx.exec(func() {
+		if ctx.v8context == nil {
+			err = ErrContextDestroyed
+			return
+		}
+		if err = v.check(); err != nil {
+			return
+		}
+		if kind := ctx.kind(v); kind != C.VALUE_FUNCTION {
+			err = &NotCallableError{Kind: kindNames[kind]}
+			return
+		}
+		var argv []*Value
+		if argv, err = ctx.toJSArgs(args); err != nil {
+			return
+		}
+		defer ctx.releaseValues(argv...)
+		// always allocate at least one so &argPtrs[0] works.
+		argPtrs := make([]C.PersistentValuePtr, len(argv)+1)
+		for i := range argv {
+			argPtrs[i] = argv[i].ptr
+		}
+		ret := C.v8_new_instance(ctx.v8context, v.ptr, C.int(len(argv)), &argPtrs[0])
+		runtime.KeepAlive(v)
+		if ret == nil {
+			if C.v8_context_has_terminated(ctx.v8context) {
+				err = ErrTerminated
+				return
+			}
+			err = errors.New(takeCString(C.v8_error(ctx.v8context)))
+			return
+		}
+		res = ctx.newValue(ret)
+	})
+	return res, err
+}
+
+// CallMethod calls the named method of the object held by v, with v as this.
+// The arguments may be *Values or Go values, which are converted with
+// ToValue.
+func (v *Value) CallMethod(name string, args ...interface{}) (*Value, error) {
+	if v == nil {
+		return nil, ErrNilValue
+	}
+	if v.ctx == nil {
+		return nil, ErrContextDestroyed
+	}
+	ctx := v.ctx
+	var res *Value
+	var err error
+	ctx.exec(func() {
+		if ctx.v8context == nil {
+			err = ErrContextDestroyed
+			return
+		}
+		if err = v.check(); err != nil {
+			return
+		}
+		var fn *Value
+		if fn, err = ctx.get(v, name); err != nil {
+			return
+		}
+		defer ctx.releaseValues(fn)
+		if kind := ctx.kind(fn); kind != C.VALUE_FUNCTION {
+			err = &NotCallableError{Kind: kindNames[kind], Method: name}
+			return
+		}
+		var argv []*Value
+		if argv, err = ctx.toJSArgs(args); err != nil {
+			return
+		}
+		defer ctx.releaseValues(argv...)
+		res, err = ctx.Apply(fn, v, argv...)
+	})
+	return res, err
+}
+
+// toJSArgs converts the arguments of a call with toJS.  It must be called
+// inside exec.
+func (v *V8Context) toJSArgs(args []interface{}) ([]*Value, error) {
+	argv := make([]*Value, 0, len(args))
+	for i, arg := range args {
+		val, err := v.toJS(arg)
+		if err != nil {
+			v.releaseValues(argv...)
+			return nil, fmt.Errorf("argument %d: %v", i+1, err)
+		}
+		argv = append(argv, val)
+	}
+	return argv, nil
+}
@@ -0,0 +1,99 @@
+package v8
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValueCall(t *testing.T) {
+	ctx := NewContext()
+	fn := evalOrFatal(t, ctx, `(function(a, b) { return [this.name, a + b.n]; })`)
+	this := evalOrFatal(t, ctx, `({name: "obj"})`)
+	res, err := fn.Call(this, 1, map[string]int{"n": 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if json := toJsonOrFatal(res, t); json != `["obj",3]` {
+		t.Errorf("Unexpected result: %s", json)
+	}
+
+	// Go values work as this too.
+	res, err = fn.Call(struct {
+		Name string `json:"name"`
+	}{"go"}, "a", map[string]string{"n": "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if json := toJsonOrFatal(res, t); json != `["go","ab"]` {
+		t.Errorf("Unexpected result: %s", json)
+	}
+
+	if _, err := fn.Call(nil, make(chan int)); err == nil || !strings.HasPrefix(err.Error(), "argument 1: ") {
+		t.Errorf("Expected an error naming the argument, got %v", err)
+	}
+}
+
+func TestValueNew(t *testing.T) {
+	ctx := NewContext()
+	point := evalOrFatal(t, ctx, `(function Point(x, y) { this.x = x; this.y = y; })`)
+	res, err := point.New(1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if json := toJsonOrFatal(res, t); json != `{"x":1,"y":2}` {
+		t.Errorf("Unexpected result: %s", json)
+	}
+
+	date, err := evalOrFatal(t, ctx, `Date`).New(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !date.IsDate() {
+		t.Error("Expected a Date")
+	}
+
+	if _, err := evalOrFatal(t, ctx, `(() => 1)`).New(); err == nil || !strings.Contains(err.Error(), "not a constructor") {
+		t.Errorf("Expected a TypeError for an arrow function, got %v", err)
+	}
+}
+
+func TestValueCallMethod(t *testing.T) {
+	ctx := NewContext()
+	arr := evalOrFatal(t, ctx, `[3, 1, 2]`)
+	res, err := arr.CallMethod("join", "-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if str, err := res.ToString(); err != nil || str != "3-1-2" {
+		t.Errorf("Expected 3-1-2, got %q, %v", str, err)
+	}
+
+	_, err = arr.CallMethod("missing")
+	if e, ok := err.(*NotCallableError); !ok || e.Method != "missing" || e.Kind != "undefined" {
+		t.Errorf("Expected a NotCallableError, got %#v", err)
+	}
+	if _, err := evalOrFatal(t, ctx, `1`).CallMethod("toFixed"); err == nil {
+		t.Error("Expected an error for a primitive receiver")
+	}
+}
+
+func TestNotCallable(t *testing.T) {
+	ctx := NewContext()
+	obj := evalOrFatal(t, ctx, `({})`)
+	checks := map[string]func() error{
+		"Call": func() error { _, err := obj.Call(nil); return err },
+		"New":  func() error { _, err := obj.New(); return err },
+		"Apply": func() error {
+			_, err := ctx.Apply(obj, nil)
+			return err
+		},
+	}
+	for name, check := range checks {
+		err := check()
+		if e, ok := err.(*NotCallableError); !ok || e.Kind != "object" {
+			t.Errorf("%s: expected a NotCallableError, got %#v", name, err)
+		} else if err.Error() != "Value is not a function but a object" {
+			t.Errorf("%s: unexpected message %q", name, err)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package v8
+
+// #include "v8wrap.h"
+import "C"
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ClassSpec describes a JS class whose instances are backed by Go values.
+// Every callback except Constructor and Static receives the Go value of the
+// instance it is called on as this.  Arguments are handles owned by the
+// context, like the arguments of a RawFunction.
+type ClassSpec struct {
+	// Constructor returns the Go value of a new instance.  If nil, the class
+	// cannot be instantiated from JS.
+	Constructor func(args ...*Value) (interface{}, error)
+
+	// Methods are set on the prototype of the class.
+	Methods map[string]Method
+
+	// Getters and Setters define accessor properties on the prototype.  A
+	// property may have a getter, a setter or both.
+	Getters map[string]Getter
+	Setters map[string]Setter
+
+	// Static functions are set on the constructor itself.  Their from
+	// argument is empty.
+	Static map[string]RawFunction
+}
+
+// Method is the callback signature of the methods of a class defined with
+// DefineClass.
+type Method func(this interface{}, args ...*Value) (*Value, error)
+
+// Getter is the callback signature of the getters of a class defined with
+// DefineClass.
+type Getter func(this interface{}) (*Value, error)
+
+// Setter is the callback signature of the setters of a class defined with
+// DefineClass.
+type Setter func(this interface{}, val *Value) error
+
+// classInstance is what the handle of an instance of a class refers to.
+type classInstance struct {
+	class *ClassSpec
+	obj   interface{}
+}
+
+// DefineClass creates a JS class named name as described by spec, sets it
+// as a global and returns its constructor.  `new Name(...)` calls
+// spec.Constructor and ties the returned Go value to the new instance until
+// the instance is garbage collected.  instanceof works as usual, and the
+// class can be extended from JS.
+func (v *V8Context) DefineClass(name string, spec ClassSpec) (*Value, error) {
+	class := &spec
+	var res *Value
+	var err error
+	v.exec(func() {
+		if v.v8context == nil {
+			err = ErrContextDestroyed
+			return
+		}
+		res, err = v.defineClass(name, class)
+	})
+	return res, err
+}
+
+func (v *V8Context) defineClass(name string, class *ClassSpec) (*Value, error) {
+	var temps []*Value
+	defer func() { v.releaseValues(temps...) }()
+
+	id := v.newHostFuncID()
+	cname := newCString(name)
+	defer freeCString(cname)
+	ptr := C.v8_new_class(v.v8context, C.uint(id), cname)
+	if ptr == nil {
+		return nil, fmt.Errorf("Cannot create class %s", name)
+	}
+	v.hostFuncsMu.Lock()
+	v.hostFuncs[id] = v.classConstructor(name, class)
+	v.hostFuncsMu.Unlock()
+	ctor := v.newValue(ptr)
+
+	proto, err := ctor.Get("prototype")
+	if err != nil {
+		return nil, err
+	}
+	temps = append(temps, proto)
+
+	for method, f := range class.Methods {
+		fn, err := v.newHostFunction(method, v.classMethod(class, f))
+		if err != nil {
+			return nil, err
+		}
+		temps = append(temps, fn)
+		if err := proto.Set(method, fn); err != nil {
+			return nil, err
+		}
+	}
+
+	props := map[string]bool{}
+	for prop := range class.Getters {
+		props[prop] = true
+	}
+	for prop := range class.Setters {
+		props[prop] = true
+	}
+	for prop := range props {
+		var getter, setter C.PersistentValuePtr
+		if f := class.Getters[prop]; f != nil {
+			fn, err := v.newHostFunction("get "+prop, v.classGetter(class, f))
+			if err != nil {
+				return nil, err
+			}
+			temps = append(temps, fn)
+			getter = fn.ptr
+		}
+		if f := class.Setters[prop]; f != nil {
+			fn, err := v.newHostFunction("set "+prop, v.classSetter(class, f))
+			if err != nil {
+				return nil, err
+			}
+			temps = append(temps, fn)
+			setter = fn.ptr
+		}
+		cprop := newCString(prop)
+		errmsg := C.v8_define_accessor(v.v8context, proto.ptr, cprop, getter, setter)
+		freeCString(cprop)
+		if errmsg != nil {
+			return nil, errors.New(C.GoString(errmsg))
+		}
+	}
+
+	for static, f := range class.Static {
+		fn, err := v.newHostFunction(static, v.staticFunction(f))
+		if err != nil {
+			return nil, err
+		}
+		temps = append(temps, fn)
+		if err := ctor.Set(static, fn); err != nil {
+			return nil, err
+		}
+	}
+
+	global := v.newValue(C.v8_global(v.v8context))
+	temps = append(temps, global)
+	if err := global.Set(name, ctor); err != nil {
+		return nil, err
+	}
+	return ctor, nil
+}
+
+func (v *V8Context) classConstructor(name string, class *ClassSpec) hostFunc {
+	return func(this *Value, args []*Value, construct bool) (*Value, error) {
+		defer v.releaseValues(this)
+		if !construct {
+			return nil, fmt.Errorf("Class constructor %s cannot be invoked without 'new'", name)
+		}
+		if class.Constructor == nil {
+			return nil, errors.New("Illegal constructor")
+		}
+		obj, err := class.Constructor(args...)
+		if err != nil {
+			return nil, err
+		}
+		handle := v.addObject(&classInstance{class, obj})
+		if !C.v8_attach_go_object(v.v8context, this.ptr, C.double(handle)) {
+			v.dropObject(handle)
+			return nil, fmt.Errorf("Cannot construct %s: receiver is not an instance", name)
+		}
+		return nil, nil
+	}
+}
+
+// instance returns the Go value of this, which must be an instance of class.
+func (v *V8Context) instance(this *Value, class *ClassSpec) (interface{}, error) {
+	if entry, ok := v.goObjectEntry(this); ok {
+		if inst, ok := entry.(*classInstance); ok && inst.class == class {
+			return inst.obj, nil
+		}
+	}
+	return nil, errors.New("Illegal invocation")
+}
+
+func (v *V8Context) classMethod(class *ClassSpec, f Method) hostFunc {
+	return func(this *Value, args []*Value, construct bool) (*Value, error) {
+		defer v.releaseValues(this)
+		obj, err := v.instance(this, class)
+		if err != nil {
+			return nil, err
+		}
+		return f(obj, args...)
+	}
+}
+
+func (v *V8Context) classGetter(class *ClassSpec, f Getter) hostFunc {
+	return func(this *Value, args []*Value, construct bool) (*Value, error) {
+		defer v.releaseValues(append(args, this)...)
+		obj, err := v.instance(this, class)
+		if err != nil {
+			return nil, err
+		}
+		return f(obj)
+	}
+}
+
+func (v *V8Context) classSetter(class *ClassSpec, f Setter) hostFunc {
+	return func(this *Value, args []*Value, construct bool) (*Value, error) {
+		defer v.releaseValues(this)
+		obj, err := v.instance(this, class)
+		if err != nil {
+			return nil, err
+		}
+		if len(args) == 0 {
+			return nil, nil
+		}
+		return nil, f(obj, args[0])
+	}
+}
+
+func (v *V8Context) staticFunction(f RawFunction) hostFunc {
+	return func(this *Value, args []*Value, construct bool) (*Value, error) {
+		defer v.releaseValues(this)
+		return f(Loc{}, args...)
+	}
+}
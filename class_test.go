@@ -0,0 +1,158 @@
+package v8
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"testing"
+)
+
+type vector struct{ x, y, z float64 }
+
+func vectorClass(t *testing.T, ctx *V8Context) ClassSpec {
+	number := func(val *Value) float64 {
+		var f float64
+		if err := decodeJSON(val, &f); err != nil {
+			t.Error(err)
+		}
+		return f
+	}
+	return ClassSpec{
+		Constructor: func(args ...*Value) (interface{}, error) {
+			if len(args) != 3 {
+				return nil, errors.New("Expected 3 coordinates")
+			}
+			return &vector{number(args[0]), number(args[1]), number(args[2])}, nil
+		},
+		Methods: map[string]Method{
+			"add": func(this interface{}, args ...*Value) (*Value, error) {
+				v := this.(*vector)
+				if len(args) == 0 {
+					return nil, errors.New("Expected a Vector")
+				}
+				other, ok := goValueOf(ctx, args[0])
+				if !ok {
+					return nil, errors.New("Expected a Vector")
+				}
+				o := other.(*vector)
+				v.x, v.y, v.z = v.x+o.x, v.y+o.y, v.z+o.z
+				return nil, nil
+			},
+		},
+		Getters: map[string]Getter{
+			"length": func(this interface{}) (*Value, error) {
+				v := this.(*vector)
+				return ctx.ToValue(math.Sqrt(v.x*v.x + v.y*v.y + v.z*v.z))
+			},
+			"x": func(this interface{}) (*Value, error) {
+				return ctx.ToValue(this.(*vector).x)
+			},
+		},
+		Setters: map[string]Setter{
+			"x": func(this interface{}, val *Value) error {
+				this.(*vector).x = number(val)
+				return nil
+			},
+		},
+		Static: map[string]RawFunction{
+			"zero": func(_ Loc, args ...*Value) (*Value, error) {
+				return ctx.EvalRaw(`new Vector(0, 0, 0)`, NO_FILE)
+			},
+		},
+	}
+}
+
+func goValueOf(ctx *V8Context, val *Value) (interface{}, bool) {
+	var obj interface{}
+	var ok bool
+	ctx.exec(func() { obj, ok = ctx.goObject(val) })
+	return obj, ok
+}
+
+func goObjects(ctx *V8Context) int {
+	ctx.objectsMu.Lock()
+	defer ctx.objectsMu.Unlock()
+	return len(ctx.objects)
+}
+
+func TestDefineClass(t *testing.T) {
+	ctx := NewContext()
+	if _, err := ctx.DefineClass("Vector", vectorClass(t, ctx)); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := ctx.Eval(`
+		var v = new Vector(1, 2, 2);
+		var r = [v.length, v instanceof Vector];
+		v.add(new Vector(1, 0, 0));
+		v.x = v.x * 2;
+		r.concat([v.x, Vector.zero().length]);
+	`, NO_FILE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []interface{}{3.0, true, 4.0, 0.0}
+	got := res.([]interface{})
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("Expected %v, got %v", expected, got)
+			break
+		}
+	}
+}
+
+func TestDefineClassInheritance(t *testing.T) {
+	ctx := NewContext()
+	if _, err := ctx.DefineClass("Vector", vectorClass(t, ctx)); err != nil {
+		t.Fatal(err)
+	}
+	res, err := ctx.Eval(`
+		class Unit extends Vector {
+			constructor() { super(1, 0, 0); }
+			twice() { return this.length * 2; }
+		}
+		var u = new Unit();
+		[u instanceof Vector, u instanceof Unit, u.twice()];
+	`, NO_FILE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := res.([]interface{}); got[0] != true || got[1] != true || got[2] != 2.0 {
+		t.Errorf("Unexpected result: %v", got)
+	}
+}
+
+func TestDefineClassErrors(t *testing.T) {
+	ctx := NewContext()
+	if _, err := ctx.DefineClass("Vector", vectorClass(t, ctx)); err != nil {
+		t.Fatal(err)
+	}
+	for js, msg := range map[string]string{
+		`Vector(1, 2, 3)`:                  "without 'new'",
+		`new Vector(1)`:                    "Expected 3 coordinates",
+		`Vector.prototype.add.call({}, 1)`: "Illegal invocation",
+		`new Vector(1, 2, 3).add({})`:      "Expected a Vector",
+		`Object.getOwnPropertyDescriptor(Vector.prototype, "length").get.call(1)`: "Illegal invocation",
+	} {
+		_, err := ctx.Eval(js, NO_FILE)
+		if err == nil || !strings.Contains(err.Error(), msg) {
+			t.Errorf("%s: expected an error containing %q, got %v", js, msg, err)
+		}
+	}
+}
+
+func TestDefineClassReleasesInstances(t *testing.T) {
+	ctx := NewContext()
+	if _, err := ctx.DefineClass("Vector", vectorClass(t, ctx)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ctx.Eval(`for (var i = 0; i < 100; i++) new Vector(i, i, i);`, NO_FILE); err != nil {
+		t.Fatal(err)
+	}
+	ctx.ClearValues()
+
+	ctx.v8isolate.collectGarbage()
+	if n := goObjects(ctx); n > 0 {
+		t.Errorf("Expected collected instances to be released, %d remain", n)
+	}
+}
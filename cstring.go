@@ -0,0 +1,24 @@
+package v8
+
+// #include <stdlib.h>
+// #include "v8wrap.h"
+import "C"
+
+import "unsafe"
+
+// newCString copies s to C memory, for C functions taking a String.  Unlike
+// C.CString, it keeps any NUL bytes.  The result must be freed with
+// freeCString.
+func newCString(s string) C.String {
+	return C.String{ptr: (*C.char)(C.CBytes([]byte(s))), len: C.int(len(s))}
+}
+
+func freeCString(s C.String) {
+	C.free(unsafe.Pointer(s.ptr))
+}
+
+// takeCString converts a String allocated by C, and frees it.
+func takeCString(s C.String) string {
+	defer C.free(unsafe.Pointer(s.ptr))
+	return C.GoStringN(s.ptr, s.len)
+}
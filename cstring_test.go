@@ -0,0 +1,107 @@
+package v8
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestStringsKeepNULs(t *testing.T) {
+	ctx := NewContext()
+
+	// Source code.
+	if res, err := ctx.Eval("'a\x00b'.length + ['x\x00y.js'].length", "file\x00name.js"); err != nil {
+		t.Fatal(err)
+	} else if res != 4.0 {
+		t.Errorf("Expected 4, got %v", res)
+	}
+
+	// Results.
+	str, err := evalOrFatal(t, ctx, `"c\u0000d"`).ToString()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if str != "c\x00d" {
+		t.Errorf("Expected c\\x00d, got %q", str)
+	}
+	if res, err := ctx.Eval(`"e\u0000f"`, NO_FILE); err != nil || res != "e\x00f" {
+		t.Errorf("Expected e\\x00f, got %q, %v", res, err)
+	}
+
+	// Field names, from both sides.
+	obj := evalOrFatal(t, ctx, `({"g\u0000h": 1})`)
+	props, err := obj.Burst()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := props["g\x00h"]; !ok || len(props) != 1 {
+		t.Errorf("Expected the key g\\x00h, got %v", props)
+	}
+	one, _ := ctx.ToValue(1)
+	if err := obj.Set("i\x00j", one); err != nil {
+		t.Fatal(err)
+	}
+	keys, err := ctx.Apply(evalOrFatal(t, ctx, `(function(o) { return Object.keys(o); })`), nil, obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if json := toJsonOrFatal(keys, t); json != `["g\u0000h","i\u0000j"]` {
+		t.Errorf("Unexpected keys: %s", json)
+	}
+
+	// Callback arguments, results and errors.
+	ctx.AddRawFunc("echo", func(_ Loc, args ...*Value) (*Value, error) {
+		str, err := args[0].ToString()
+		if err != nil {
+			return nil, err
+		}
+		if str == "fail" {
+			return nil, errors.New("failed\x00here")
+		}
+		return ctx.ToValue(str + "\x00")
+	})
+	if res, err := ctx.Eval(`echo("k\u0000l")`, NO_FILE); err != nil || res != "k\x00l\x00" {
+		t.Errorf("Expected k\\x00l\\x00, got %q, %v", res, err)
+	}
+	if res, err := ctx.Eval(`try { echo("fail"); } catch (e) { e.message }`, NO_FILE); err != nil || res != "failed\x00here" {
+		t.Errorf("Expected the error message to be kept, got %q, %v", res, err)
+	}
+	_, err = ctx.Eval(`throw new Error("m\u0000n")`, NO_FILE)
+	if err == nil || !strings.Contains(err.Error(), "m\x00n") {
+		t.Errorf("Expected the error to keep its NUL, got %q", err)
+	}
+}
+
+func TestUTF16(t *testing.T) {
+	ctx := NewContext()
+	units, err := evalOrFatal(t, ctx, `"\ud800xé"`).ToUTF16()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []uint16{0xd800, 'x', 0xe9}; !reflect.DeepEqual(units, expected) {
+		t.Errorf("Expected %v, got %v", expected, units)
+	}
+
+	str, err := ctx.NewStringUTF16([]uint16{'a', 0xdc00, 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	check := evalOrFatal(t, ctx, `(function(s) { return s.length === 3 && s.charCodeAt(1) === 0xdc00 && s.charCodeAt(2) === 0; })`)
+	if res, err := ctx.Apply(check, nil, str); err != nil {
+		t.Fatal(err)
+	} else if json := toJsonOrFatal(res, t); json != "true" {
+		t.Errorf("Expected the code units to be kept, got %s", json)
+	}
+
+	empty, err := ctx.NewStringUTF16(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if units, err := empty.ToUTF16(); err != nil || len(units) != 0 {
+		t.Errorf("Expected no code units, got %v, %v", units, err)
+	}
+	if _, err := evalOrFatal(t, ctx, `1`).ToUTF16(); err == nil {
+		t.Error("Expected an error for a non-string")
+	}
+}
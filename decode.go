@@ -0,0 +1,788 @@
+package v8
+
+// #include "v8wrap.h"
+import "C"
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	timeType             = reflect.TypeOf(time.Time{})
+	jsonUnmarshalerType  = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	mapStringInterface   = reflect.TypeOf(map[string]interface{}{})
+	sliceOfInterfaceType = reflect.TypeOf([]interface{}{})
+)
+
+// maxSparseLength is the largest length decoded for arrays with holes, so
+// that a single element at a huge index can't exhaust memory.
+const maxSparseLength = 1 << 20
+
+var kindNames = map[C.ValueKind]string{
+	C.VALUE_UNDEFINED: "undefined",
+	C.VALUE_NULL:      "null",
+	C.VALUE_BOOLEAN:   "boolean",
+	C.VALUE_NUMBER:    "number",
+	C.VALUE_STRING:    "string",
+	C.VALUE_SYMBOL:    "symbol",
+	C.VALUE_FUNCTION:  "function",
+	C.VALUE_ARRAY:     "array",
+	C.VALUE_DATE:      "date",
+	C.VALUE_MAP:       "map",
+	C.VALUE_SET:       "set",
+	C.VALUE_BIGINT:    "bigint",
+	C.VALUE_REGEXP:    "regexp",
+	C.VALUE_OBJECT:    "object",
+}
+
+// DecodeError reports a JS value that cannot be stored in a Go value.
+type DecodeError struct {
+	// Path locates the value within the decoded one, e.g. "items[2].name".
+	// It is empty for the decoded value itself.
+	Path string
+	Msg  string
+}
+
+func (e *DecodeError) Error() string {
+	if e.Path == "" {
+		return e.Msg
+	}
+	return e.Path + ": " + e.Msg
+}
+
+// Decode stores the JS value v in the Go value pointed to by dst, converting
+// it natively rather than through JSON:
+//
+//   - Booleans, numbers and strings become the matching Go scalars; numbers
+//     must be integral and in range for integer types.
+//   - Arrays and Sets become slices or arrays.
+//   - Objects become structs or maps, and Maps become maps.  Struct fields
+//     are matched like in Wrap, by "js" tag, then "json" tag, then name.
+//   - Dates become time.Time, and BigInts big.Int.
+//   - undefined and null leave pointers, maps, slices and interfaces nil.
+//   - Values behind Wrap, NewExternal and DefineClass objects are used as is.
+//   - Types implementing Unmarshaler decode themselves with FromJS, and
+//     those implementing json.Unmarshaler from the value's JSON.
+//
+// Fields and elements of type *Value receive the JS value unconverted; they
+// are owned by the context like any other Value.  Only the own enumerable
+// properties of objects are decoded, like JSON.stringify does.
+//
+// Into interface{}, numbers become float64, arrays and Sets []interface{},
+// and objects and Maps map[string]interface{}, like with json.Unmarshal, but
+// Maps with keys other than strings fail to decode.  Unlike with JSON, Dates
+// become time.Time and BigInts *big.Int, and functions, symbols and RegExps
+// become nil.
+//
+// A JS object reachable several times is decoded into the same Go pointer
+// each time, so shared references and cycles survive when decoding into
+// pointers.
+//
+// Errors are *DecodeErrors locating the offending value.
+func (v *Value) Decode(dst interface{}) error {
+	rv := reflect.ValueOf(dst)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("Cannot decode into %T: expected a non-nil pointer", dst)
+	}
+	if v == nil {
+		return ErrNilValue
+	}
+	if v.ctx == nil {
+		return ErrContextDestroyed
+	}
+	var err error
+	v.ctx.exec(func() {
+		if err = v.check(); err != nil {
+			return
+		}
+		d := v.ctx.newDecoder()
+		defer d.release()
+		err = d.decode(v, "", rv.Elem())
+	})
+	return err
+}
+
+// fromJS converts val to a Go value of type t.  A nil val stands for
+// undefined.  It must be called inside exec.
+func (v *V8Context) fromJS(val *Value, t reflect.Type) (reflect.Value, error) {
+	res := reflect.New(t).Elem()
+	d := v.newDecoder()
+	defer d.release()
+	return res, d.decode(val, "", res)
+}
+
+// kind returns the kind of val, treating nil as undefined.  It must be called
+// inside exec.
+func (v *V8Context) kind(val *Value) C.ValueKind {
+	if val == nil {
+		return C.VALUE_UNDEFINED
+	}
+	kind := C.v8_value_kind(v.v8context, val.ptr)
+	runtime.KeepAlive(val)
+	return kind
+}
+
+type decoder struct {
+	ctx *V8Context
+
+	// Go pointers JS objects were decoded into, by identity hash.
+	pointers map[int][]decodedPointer
+	// The JS objects being decoded, to detect cycles.
+	stack []*Value
+	// Values created while decoding, and those handed out as *Values.
+	temps []*Value
+	kept  map[*Value]bool
+}
+
+type decodedPointer struct {
+	val *Value
+	ptr reflect.Value
+}
+
+func (v *V8Context) newDecoder() *decoder {
+	return &decoder{
+		ctx:      v,
+		pointers: make(map[int][]decodedPointer),
+		kept:     make(map[*Value]bool),
+	}
+}
+
+// release releases the values created while decoding.
+func (d *decoder) release() {
+	for _, val := range d.temps {
+		if !d.kept[val] {
+			d.ctx.releaseValues(val)
+		}
+	}
+}
+
+func (d *decoder) decode(val *Value, path string, dst reflect.Value) error {
+	// Nested values are kept alive by d.temps, but val may be the caller's.
+	defer runtime.KeepAlive(val)
+	t := dst.Type()
+	if t == valueType {
+		if val != nil {
+			d.kept[val] = true
+			dst.Set(reflect.ValueOf(val))
+		}
+		return nil
+	}
+	if val != nil {
+		if obj, ok := d.ctx.goObject(val); ok && obj != nil {
+			rv := reflect.ValueOf(obj)
+			if rv.Type().AssignableTo(t) {
+				dst.Set(rv)
+				return nil
+			}
+			if rv.Kind() == reflect.Ptr && rv.Elem().Type().AssignableTo(t) {
+				dst.Set(rv.Elem())
+				return nil
+			}
+		}
+	}
+
+	kind := d.ctx.kind(val)
+	fail := func(format string, args ...interface{}) error {
+		return &DecodeError{path, fmt.Sprintf(format, args...)}
+	}
+	mismatch := func(expected string) error {
+		return fail("expected %s, got %s", expected, kindNames[kind])
+	}
+
+	if t == timeType {
+		switch kind {
+		case C.VALUE_DATE:
+			ms := float64(C.v8_value_number(d.ctx.v8context, val.ptr))
+			if math.IsNaN(ms) {
+				return fail("invalid date")
+			}
+			dst.Set(reflect.ValueOf(msToTime(ms)))
+			return nil
+		case C.VALUE_STRING:
+			tm, err := time.Parse(time.RFC3339Nano, d.string(val))
+			if err != nil {
+				return fail("%v", err)
+			}
+			dst.Set(reflect.ValueOf(tm))
+			return nil
+		}
+		return mismatch("date")
+	}
+	if t == bigIntType.Elem() {
+		switch kind {
+		case C.VALUE_BIGINT:
+			dst.Set(reflect.ValueOf(d.ctx.bigInt(val)).Elem())
+			return nil
+		case C.VALUE_NUMBER:
+			f := float64(C.v8_value_number(d.ctx.v8context, val.ptr))
+			if f != math.Trunc(f) || math.IsInf(f, 0) {
+				return fail("expected integer, got %v", f)
+			}
+			n, _ := big.NewFloat(f).Int(nil)
+			dst.Set(reflect.ValueOf(n).Elem())
+			return nil
+		}
+		return mismatch("bigint")
+	}
+	if t.Kind() != reflect.Ptr && reflect.PtrTo(t).Implements(unmarshalerType) {
+		if kind == C.VALUE_UNDEFINED {
+			return nil
+		}
+		if err := dst.Addr().Interface().(Unmarshaler).FromJS(val); err != nil {
+			return fail("%v", err)
+		}
+		return nil
+	}
+	if t.Kind() != reflect.Ptr && reflect.PtrTo(t).Implements(jsonUnmarshalerType) {
+		if kind == C.VALUE_UNDEFINED {
+			return nil
+		}
+		str, err := val.ToJSON()
+		if err != nil {
+			return fail("%v", err)
+		}
+		if err := json.Unmarshal([]byte(str), dst.Addr().Interface()); err != nil {
+			return fail("%v", err)
+		}
+		return nil
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		if kind != C.VALUE_BOOLEAN {
+			return mismatch("boolean")
+		}
+		dst.SetBool(bool(C.v8_value_bool(d.ctx.v8context, val.ptr)))
+		return nil
+
+	case reflect.String:
+		if kind != C.VALUE_STRING {
+			return mismatch("string")
+		}
+		dst.SetString(d.string(val))
+		return nil
+
+	case reflect.Float32, reflect.Float64:
+		if kind != C.VALUE_NUMBER {
+			return mismatch("number")
+		}
+		dst.SetFloat(float64(C.v8_value_number(d.ctx.v8context, val.ptr)))
+		return nil
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if kind != C.VALUE_NUMBER {
+			return mismatch("number")
+		}
+		if err := setInteger(dst, float64(C.v8_value_number(d.ctx.v8context, val.ptr))); err != nil {
+			return fail("%v", err)
+		}
+		return nil
+
+	case reflect.Interface:
+		if kind == C.VALUE_UNDEFINED || kind == C.VALUE_NULL {
+			dst.Set(reflect.Zero(t))
+			return nil
+		}
+		if t.NumMethod() != 0 {
+			return fail("cannot decode %s into %v", kindNames[kind], t)
+		}
+		res, err := d.decodeAny(val, kind, path)
+		if err != nil {
+			return err
+		}
+		if res == nil {
+			dst.Set(reflect.Zero(t))
+		} else {
+			dst.Set(reflect.ValueOf(res))
+		}
+		return nil
+
+	case reflect.Ptr:
+		if kind == C.VALUE_UNDEFINED || kind == C.VALUE_NULL {
+			dst.Set(reflect.Zero(t))
+			return nil
+		}
+		if ptr, ok := d.decoded(val, t); ok {
+			dst.Set(ptr)
+			return nil
+		}
+		ptr := reflect.New(t.Elem())
+		if hash := int(C.v8_identity_hash(d.ctx.v8context, val.ptr)); hash != 0 {
+			d.pointers[hash] = append(d.pointers[hash], decodedPointer{val, ptr})
+		}
+		if err := d.decode(val, path, ptr.Elem()); err != nil {
+			return err
+		}
+		dst.Set(ptr)
+		return nil
+
+	case reflect.Slice:
+		if kind == C.VALUE_UNDEFINED || kind == C.VALUE_NULL {
+			dst.Set(reflect.Zero(t))
+			return nil
+		}
+		if kind != C.VALUE_ARRAY && kind != C.VALUE_SET {
+			return mismatch("array")
+		}
+		return d.within(val, path, func() error {
+			items, err := d.items(val, kind, path)
+			if err != nil {
+				return err
+			}
+			res := reflect.MakeSlice(t, len(items), len(items))
+			for i, item := range items {
+				if err := d.decode(item, fmt.Sprintf("%s[%d]", path, i), res.Index(i)); err != nil {
+					return err
+				}
+			}
+			dst.Set(res)
+			return nil
+		})
+
+	case reflect.Array:
+		if kind != C.VALUE_ARRAY && kind != C.VALUE_SET {
+			return mismatch("array")
+		}
+		return d.within(val, path, func() error {
+			items, err := d.items(val, kind, path)
+			if err != nil {
+				return err
+			}
+			if len(items) > t.Len() {
+				return fail("array of length %d overflows %v", len(items), t)
+			}
+			for i, item := range items {
+				if err := d.decode(item, fmt.Sprintf("%s[%d]", path, i), dst.Index(i)); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+
+	case reflect.Map:
+		if kind == C.VALUE_UNDEFINED || kind == C.VALUE_NULL {
+			dst.Set(reflect.Zero(t))
+			return nil
+		}
+		if kind != C.VALUE_OBJECT && kind != C.VALUE_MAP {
+			return mismatch("object")
+		}
+		return d.within(val, path, func() error {
+			res := reflect.MakeMap(t)
+			err := d.entries(val, kind, path, func(key *Value, name string, item *Value, keyPath string) error {
+				k := reflect.New(t.Key()).Elem()
+				if err := d.decodeKey(key, name, keyPath, k); err != nil {
+					return err
+				}
+				elem := reflect.New(t.Elem()).Elem()
+				if err := d.decode(item, keyPath, elem); err != nil {
+					return err
+				}
+				res.SetMapIndex(k, elem)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			dst.Set(res)
+			return nil
+		})
+
+	case reflect.Struct:
+		if kind != C.VALUE_OBJECT {
+			return mismatch("object")
+		}
+		fields := wrapFields(t)
+		return d.within(val, path, func() error {
+			props, err := d.burst(val, path)
+			if err != nil {
+				return err
+			}
+			for name, prop := range props {
+				field, ok := findField(fields, name)
+				if !ok {
+					continue
+				}
+				if err := d.decode(prop, joinPath(path, name), dst.FieldByIndex(field.index)); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+	return fail("cannot decode into %v", t)
+}
+
+// decodeAny decodes val the way json.Unmarshal decodes into interface{}.
+func (d *decoder) decodeAny(val *Value, kind C.ValueKind, path string) (interface{}, error) {
+	defer runtime.KeepAlive(val)
+	var dst reflect.Value
+	switch kind {
+	case C.VALUE_BOOLEAN:
+		return bool(C.v8_value_bool(d.ctx.v8context, val.ptr)), nil
+	case C.VALUE_NUMBER:
+		return float64(C.v8_value_number(d.ctx.v8context, val.ptr)), nil
+	case C.VALUE_STRING:
+		return d.string(val), nil
+	case C.VALUE_DATE:
+		dst = reflect.New(timeType).Elem()
+	case C.VALUE_BIGINT:
+		return d.ctx.bigInt(val), nil
+	case C.VALUE_ARRAY, C.VALUE_SET:
+		dst = reflect.New(sliceOfInterfaceType).Elem()
+	case C.VALUE_OBJECT, C.VALUE_MAP:
+		dst = reflect.New(mapStringInterface).Elem()
+	default:
+		// Like JSON, functions, symbols and RegExps have no Go equivalent.
+		return nil, nil
+	}
+	if err := d.decode(val, path, dst); err != nil {
+		return nil, err
+	}
+	return dst.Interface(), nil
+}
+
+// decodeJSON decodes val into interface{} the way JSON.stringify followed by
+// json.Unmarshal would, passing key to toJSON methods.  It returns false if
+// JSON.stringify would leave val out.
+func (d *decoder) decodeJSON(val *Value, key string, path string) (interface{}, bool, error) {
+	val, kind, err := d.jsonValue(val, key, path)
+	if err != nil {
+		return nil, false, err
+	}
+	defer runtime.KeepAlive(val)
+	switch kind {
+	case C.VALUE_UNDEFINED, C.VALUE_FUNCTION, C.VALUE_SYMBOL:
+		return nil, false, nil
+	case C.VALUE_NULL:
+		return nil, true, nil
+	case C.VALUE_BOOLEAN:
+		return bool(C.v8_value_bool(d.ctx.v8context, val.ptr)), true, nil
+	case C.VALUE_NUMBER:
+		f := float64(C.v8_value_number(d.ctx.v8context, val.ptr))
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return nil, true, nil
+		}
+		return f, true, nil
+	case C.VALUE_STRING:
+		return d.string(val), true, nil
+	case C.VALUE_BIGINT:
+		return nil, false, &DecodeError{path, "Do not know how to serialize a BigInt"}
+	case C.VALUE_ARRAY:
+		var res []interface{}
+		err := d.within(val, path, func() error {
+			items, err := d.elements(val, path)
+			if err != nil {
+				return err
+			}
+			res = make([]interface{}, len(items))
+			for i, item := range items {
+				// Holes and left out items are null, like in JSON.
+				if res[i], _, err = d.decodeJSON(item, strconv.Itoa(i), fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		return res, true, err
+	}
+
+	// Everything else, Maps, Sets and RegExps included, is an object of its
+	// own enumerable properties.
+	res := make(map[string]interface{})
+	err = d.within(val, path, func() error {
+		items, err := d.properties(val, path)
+		if err != nil {
+			return err
+		}
+		for i := 0; i+1 < len(items); i += 2 {
+			name := d.string(items[i])
+			item, ok, err := d.decodeJSON(items[i+1], name, joinPath(path, name))
+			if err != nil {
+				return err
+			}
+			if ok {
+				res[name] = item
+			}
+		}
+		return nil
+	})
+	return res, true, err
+}
+
+// jsonValue returns the value JSON.stringify serializes for val: the result
+// of its toJSON method, if it has one, or val itself.
+func (d *decoder) jsonValue(val *Value, key string, path string) (*Value, C.ValueKind, error) {
+	kind := d.ctx.kind(val)
+	switch kind {
+	case C.VALUE_UNDEFINED, C.VALUE_NULL, C.VALUE_BOOLEAN, C.VALUE_NUMBER,
+		C.VALUE_STRING, C.VALUE_SYMBOL, C.VALUE_BIGINT:
+		return val, kind, nil
+	}
+	toJSON, err := d.ctx.get(val, "toJSON")
+	if err != nil {
+		return nil, kind, d.wrap(err, path)
+	}
+	d.temps = append(d.temps, toJSON)
+	if d.ctx.kind(toJSON) != C.VALUE_FUNCTION {
+		return val, kind, nil
+	}
+	arg, err := d.ctx.toJS(key)
+	if err != nil {
+		return nil, kind, d.wrap(err, path)
+	}
+	d.temps = append(d.temps, arg)
+	res, err := d.ctx.Apply(toJSON, val, arg)
+	if err != nil {
+		return nil, kind, d.wrap(err, path)
+	}
+	d.temps = append(d.temps, res)
+	return res, d.ctx.kind(res), nil
+}
+
+// error returns the last error of the context as a DecodeError at path.
+func (d *decoder) error(path string) error {
+	if C.v8_context_has_terminated(d.ctx.v8context) {
+		return ErrTerminated
+	}
+	return &DecodeError{path, takeCString(C.v8_error(d.ctx.v8context))}
+}
+
+// wrap makes err a DecodeError at path, unless execution was terminated.
+func (d *decoder) wrap(err error, path string) error {
+	if err == ErrTerminated {
+		return err
+	}
+	return &DecodeError{path, err.Error()}
+}
+
+// decodeKey decodes the key of an object or Map into dst.  Object keys are
+// passed as name, with a nil key.
+func (d *decoder) decodeKey(key *Value, name string, path string, dst reflect.Value) error {
+	str := name
+	if key != nil {
+		if C.v8_value_kind(d.ctx.v8context, key.ptr) != C.VALUE_STRING {
+			return d.decode(key, path, dst)
+		}
+		str = d.string(key)
+	}
+	switch dst.Kind() {
+	case reflect.String:
+		dst.SetString(str)
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		f, err := strconv.ParseFloat(str, 64)
+		if err == nil {
+			err = setInteger(dst, f)
+		}
+		if err != nil {
+			return &DecodeError{path, fmt.Sprintf("invalid key %q for %v", str, dst.Type())}
+		}
+		return nil
+	case reflect.Interface:
+		if dst.NumMethod() == 0 {
+			dst.Set(reflect.ValueOf(str))
+			return nil
+		}
+	}
+	return &DecodeError{path, fmt.Sprintf("cannot decode key %q into %v", str, dst.Type())}
+}
+
+// decoded returns the Go pointer of type t val was decoded into before.
+func (d *decoder) decoded(val *Value, t reflect.Type) (reflect.Value, bool) {
+	hash := int(C.v8_identity_hash(d.ctx.v8context, val.ptr))
+	if hash == 0 {
+		return reflect.Value{}, false
+	}
+	for _, p := range d.pointers[hash] {
+		if p.ptr.Type() == t && bool(C.v8_strict_equals(d.ctx.v8context, p.val.ptr, val.ptr)) {
+			return p.ptr, true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+// within calls f with val marked as being decoded, failing if it already is,
+// unless val is being decoded into a pointer: further references to it reuse
+// the pointer instead of recursing.
+func (d *decoder) within(val *Value, path string, f func() error) error {
+	hash := int(C.v8_identity_hash(d.ctx.v8context, val.ptr))
+	for _, p := range d.pointers[hash] {
+		if p.val == val {
+			return f()
+		}
+	}
+	for _, ancestor := range d.stack {
+		if C.v8_strict_equals(d.ctx.v8context, ancestor.ptr, val.ptr) {
+			return &DecodeError{path, "cycle detected; decode into pointers to keep cycles"}
+		}
+	}
+	d.stack = append(d.stack, val)
+	defer func() { d.stack = d.stack[:len(d.stack)-1] }()
+	return f()
+}
+
+func (d *decoder) string(val *Value) string {
+	return takeCString(C.v8_value_string(d.ctx.v8context, val.ptr))
+}
+
+// burst returns the own enumerable properties of val, like Object.keys.
+func (d *decoder) burst(val *Value, path string) (map[string]*Value, error) {
+	items, err := d.properties(val, path)
+	if err != nil {
+		return nil, err
+	}
+	props := make(map[string]*Value, len(items)/2)
+	for i := 0; i+1 < len(items); i += 2 {
+		props[d.string(items[i])] = items[i+1]
+	}
+	return props, nil
+}
+
+// properties returns the keys and values of the own enumerable properties of
+// val alternately, like Object.entries.
+func (d *decoder) properties(val *Value, path string) ([]*Value, error) {
+	ptr := C.v8_properties(d.ctx.v8context, val.ptr, 0, true)
+	runtime.KeepAlive(val)
+	if ptr == nil {
+		return nil, d.error(path)
+	}
+	props := d.ctx.newValue(ptr)
+	d.temps = append(d.temps, props)
+	return d.elements(props, path)
+}
+
+// elements returns the elements of the array val, up to its length; holes
+// are nil.
+func (d *decoder) elements(val *Value, path string) ([]*Value, error) {
+	length, err := d.ctx.get(val, "length")
+	if err != nil {
+		return nil, d.wrap(err, path)
+	}
+	d.temps = append(d.temps, length)
+	n := uint64(0)
+	if d.ctx.kind(length) == C.VALUE_NUMBER {
+		n = uint64(C.v8_value_number(d.ctx.v8context, length.ptr))
+	}
+	props, err := val.Burst()
+	if err != nil {
+		return nil, &DecodeError{path, err.Error()}
+	}
+	indices := make(map[uint32]*Value, len(props))
+	for key, prop := range props {
+		d.temps = append(d.temps, prop)
+		if i, ok := arrayIndex(key); ok && uint64(i) < n {
+			indices[i] = prop
+		}
+	}
+	if n > uint64(len(indices)) && n > maxSparseLength {
+		return nil, &DecodeError{path, fmt.Sprintf("sparse array of length %d is too long", n)}
+	}
+	items := make([]*Value, n)
+	for i, prop := range indices {
+		items[i] = prop
+	}
+	return items, nil
+}
+
+// items returns the elements of an array, or the values of a Set.
+func (d *decoder) items(val *Value, kind C.ValueKind, path string) ([]*Value, error) {
+	if kind == C.VALUE_SET {
+		val = d.ctx.newValue(C.v8_set_values(d.ctx.v8context, val.ptr))
+		d.temps = append(d.temps, val)
+	}
+	return d.elements(val, path)
+}
+
+// entries calls f with the key and value of each property of an object, or
+// each entry of a Map.  The keys of objects are passed as name, with a nil
+// key.
+func (d *decoder) entries(val *Value, kind C.ValueKind, path string, f func(key *Value, name string, item *Value, path string) error) error {
+	if kind == C.VALUE_MAP {
+		flat := d.ctx.newValue(C.v8_map_entries(d.ctx.v8context, val.ptr))
+		d.temps = append(d.temps, flat)
+		items, err := d.elements(flat, path)
+		if err != nil {
+			return err
+		}
+		for i := 0; i+1 < len(items); i += 2 {
+			keyPath := fmt.Sprintf("%s[%d]", path, i/2)
+			if C.v8_value_kind(d.ctx.v8context, items[i].ptr) == C.VALUE_STRING {
+				keyPath = joinPath(path, d.string(items[i]))
+			}
+			if err := f(items[i], "", items[i+1], keyPath); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	props, err := d.burst(val, path)
+	if err != nil {
+		return err
+	}
+	for name, prop := range props {
+		if err := f(nil, name, prop, joinPath(path, name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// msToTime converts a JS time value, in milliseconds since the epoch.
+func msToTime(ms float64) time.Time {
+	sec := math.Floor(ms / 1e3)
+	return time.Unix(int64(sec), int64((ms-sec*1e3)*1e6))
+}
+
+func findField(fields []wrapField, name string) (wrapField, bool) {
+	for _, f := range fields {
+		if f.name == name {
+			return f, true
+		}
+	}
+	for _, f := range fields {
+		if strings.EqualFold(f.name, name) {
+			return f, true
+		}
+	}
+	return wrapField{}, false
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// setInteger stores f in the integer res, failing if f isn't an integer or
+// doesn't fit.
+func setInteger(res reflect.Value, f float64) error {
+	if f != math.Trunc(f) || math.IsInf(f, 0) {
+		return fmt.Errorf("expected integer, got %v", f)
+	}
+	switch res.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if res.OverflowInt(int64(f)) || f < math.MinInt64 || f >= math.MaxInt64 {
+			return fmt.Errorf("%v overflows %v", f, res.Type())
+		}
+		res.SetInt(int64(f))
+	default:
+		if f < 0 || res.OverflowUint(uint64(f)) || f >= math.MaxUint64 {
+			return fmt.Errorf("%v overflows %v", f, res.Type())
+		}
+		res.SetUint(uint64(f))
+	}
+	return nil
+}
@@ -0,0 +1,11 @@
+//go:build go1.18
+// +build go1.18
+
+package v8
+
+// As decodes val into a new value of type T, see Value.Decode.
+func As[T any](val *Value) (T, error) {
+	var res T
+	err := val.Decode(&res)
+	return res, err
+}
@@ -0,0 +1,28 @@
+//go:build go1.18
+// +build go1.18
+
+package v8
+
+import "testing"
+
+func TestAs(t *testing.T) {
+	ctx := NewContext()
+	val, err := ctx.EvalRaw(`({name: "pt", coords: [1, 2]})`, NO_FILE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	type point struct {
+		Name   string `json:"name"`
+		Coords []int  `json:"coords"`
+	}
+	p, err := As[point](val)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Name != "pt" || len(p.Coords) != 2 || p.Coords[1] != 2 {
+		t.Errorf("Unexpected result: %#v", p)
+	}
+	if _, err := As[int](val); err == nil {
+		t.Error("Expected an error decoding an object into an int")
+	}
+}
@@ -0,0 +1,244 @@
+package v8
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type decodeItem struct {
+	Name     string            `json:"name"`
+	Count    uint8             `js:"count"`
+	Price    float64           `json:"price,omitempty"`
+	Hidden   string            `json:"-"`
+	Tags     map[string]string `json:"tags"`
+	Callback *Value            `json:"callback"`
+	Created  time.Time         `json:"created"`
+	Next     *decodeItem       `json:"next"`
+}
+
+// decodeID is exchanged with JS as a string like "id-42".
+type decodeID int
+
+func (id decodeID) ToJS(ctx *V8Context) (*Value, error) {
+	return ctx.ToValue(fmt.Sprintf("id-%d", int(id)))
+}
+
+func (id *decodeID) FromJS(val *Value) error {
+	var str string
+	if err := val.Decode(&str); err != nil {
+		return err
+	}
+	_, err := fmt.Sscanf(str, "id-%d", (*int)(id))
+	return err
+}
+
+func evalOrFatal(t *testing.T, ctx *V8Context, js string) *Value {
+	val, err := ctx.EvalRaw(js, NO_FILE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return val
+}
+
+func TestDecodeStruct(t *testing.T) {
+	ctx := NewContext()
+	val := evalOrFatal(t, ctx, `({
+		name: "widget",
+		count: 3,
+		price: 2.5,
+		Hidden: "x",
+		tags: {color: "red"},
+		callback: function() { return 42; },
+		created: new Date(Date.UTC(2020, 0, 2)),
+		next: undefined,
+		extra: [1, 2, 3],
+	})`)
+
+	var item decodeItem
+	if err := val.Decode(&item); err != nil {
+		t.Fatal(err)
+	}
+	if item.Name != "widget" || item.Count != 3 || item.Price != 2.5 || item.Hidden != "" {
+		t.Errorf("Unexpected scalar fields: %#v", item)
+	}
+	if !reflect.DeepEqual(item.Tags, map[string]string{"color": "red"}) {
+		t.Errorf("Unexpected tags: %v", item.Tags)
+	}
+	if !item.Created.Equal(time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected date: %v", item.Created)
+	}
+	if item.Next != nil {
+		t.Errorf("Expected undefined to decode as nil, got %#v", item.Next)
+	}
+
+	// *Value fields are kept as is.
+	res, err := ctx.Apply(item.Callback, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if str := toJsonOrFatal(res, t); str != "42" {
+		t.Errorf("Expected 42, got %s", str)
+	}
+}
+
+func TestDecodeInterface(t *testing.T) {
+	ctx := NewContext()
+	val := evalOrFatal(t, ctx, `({a: [1, "two", true, null], b: new Map([["k", 1]]), f: function() {}})`)
+
+	var res interface{}
+	if err := val.Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"a": []interface{}{1.0, "two", true, nil},
+		"b": map[string]interface{}{"k": 1.0},
+		"f": nil,
+	}
+	if !reflect.DeepEqual(res, expected) {
+		t.Errorf("Expected %#v, got %#v", expected, res)
+	}
+}
+
+func TestDecodeMapKeys(t *testing.T) {
+	ctx := NewContext()
+	var byID map[int]string
+	if err := evalOrFatal(t, ctx, `({1: "a", 20: "b"})`).Decode(&byID); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(byID, map[int]string{1: "a", 20: "b"}) {
+		t.Errorf("Unexpected map: %v", byID)
+	}
+	if err := evalOrFatal(t, ctx, `new Map([[3, "c"]])`).Decode(&byID); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(byID, map[int]string{3: "c"}) {
+		t.Errorf("Unexpected map: %v", byID)
+	}
+}
+
+func TestDecodeErrorPaths(t *testing.T) {
+	ctx := NewContext()
+	for js, msg := range map[string]string{
+		`({name: 1})`:                    "name: expected string, got number",
+		`({count: 256})`:                 "count: 256 overflows uint8",
+		`({next: {next: {count: "x"}}})`: "next.next.count: expected number, got string",
+		`({tags: {a: []}})`:              "tags.a: expected string, got array",
+		`[]`:                             "expected object, got array",
+		`({next: {created: 5}})`:         "next.created: expected date, got number",
+	} {
+		var item decodeItem
+		err := evalOrFatal(t, ctx, js).Decode(&item)
+		if err == nil || err.Error() != msg {
+			t.Errorf("%s: expected error %q, got %v", js, msg, err)
+		}
+	}
+
+	var xs [][]int
+	err := evalOrFatal(t, ctx, `[[1], [2, "3"]]`).Decode(&xs)
+	if derr, ok := err.(*DecodeError); !ok || derr.Path != "[1][1]" {
+		t.Errorf("Expected an error at [1][1], got %v", err)
+	}
+}
+
+func TestDecodeSparseArrays(t *testing.T) {
+	ctx := NewContext()
+	var xs []interface{}
+	if err := evalOrFatal(t, ctx, `var a = [1, , 3]; a["01"] = 2; a.x = 4; a`).Decode(&xs); err != nil {
+		t.Fatal(err)
+	}
+	if expected := []interface{}{1.0, nil, 3.0}; !reflect.DeepEqual(xs, expected) {
+		t.Errorf("Expected %v, got %v", expected, xs)
+	}
+
+	for js, n := range map[string]int{`new Array(3)`: 3, `[1, , ]`: 2, `[, 1, , ]`: 3} {
+		if err := evalOrFatal(t, ctx, js).Decode(&xs); err != nil || len(xs) != n {
+			t.Errorf("%s: expected %d elements, got %v (err: %v)", js, n, xs, err)
+		}
+	}
+
+	for _, js := range []string{`var a = []; a[4e9] = 1; a`, `var a = [1]; a[1e7] = 1; a`} {
+		err := evalOrFatal(t, ctx, js).Decode(&xs)
+		if err == nil || !strings.Contains(err.Error(), "sparse array") {
+			t.Errorf("%s: expected a sparse array error, got %v", js, err)
+		}
+	}
+}
+
+func TestDecodeOwnProperties(t *testing.T) {
+	ctx := NewContext()
+	val := evalOrFatal(t, ctx, `var o = Object.create({name: "inherited", count: 1}); o.price = 2; o`)
+
+	var item decodeItem
+	if err := val.Decode(&item); err != nil {
+		t.Fatal(err)
+	}
+	if item.Name != "" || item.Count != 0 || item.Price != 2 {
+		t.Errorf("Expected only own properties to be decoded, got %+v", item)
+	}
+	var m map[string]interface{}
+	if err := val.Decode(&m); err != nil || !reflect.DeepEqual(m, map[string]interface{}{"price": 2.0}) {
+		t.Errorf("Expected only own properties to be decoded, got %v (err: %v)", m, err)
+	}
+}
+
+func TestDecodeCycles(t *testing.T) {
+	ctx := NewContext()
+	val := evalOrFatal(t, ctx, `var a = {name: "a"}; var b = {name: "b", next: a}; a.next = b; a`)
+
+	var item decodeItem
+	if err := val.Decode(&item); err != nil {
+		t.Fatal(err)
+	}
+	if item.Next.Name != "b" || item.Next.Next.Name != "a" || item.Next.Next.Next != item.Next {
+		t.Errorf("Expected the cycle to be preserved through pointers")
+	}
+
+	var generic interface{}
+	if err := val.Decode(&generic); err == nil {
+		t.Error("Expected an error decoding a cycle into interface{}")
+	}
+}
+
+func TestDecodeReleasesTemporaries(t *testing.T) {
+	ctx := NewContext()
+	val := evalOrFatal(t, ctx, `({name: "x", tags: {a: "b"}, next: {name: "y"}})`)
+	before := liveValues(ctx)
+	var item decodeItem
+	if err := val.Decode(&item); err != nil {
+		t.Fatal(err)
+	}
+	if live := liveValues(ctx); live != before {
+		t.Errorf("Expected decoding to leave %d live values, got %d", before, live)
+	}
+}
+
+func TestDecodeUnmarshaler(t *testing.T) {
+	ctx := NewContext()
+	var ref struct {
+		Owner decodeID
+		Items []decodeID
+		Prev  *decodeID
+	}
+	if err := evalOrFatal(t, ctx, `({Owner: "id-1", Items: ["id-2", "id-3"], Prev: "id-4"})`).Decode(&ref); err != nil {
+		t.Fatal(err)
+	}
+	if ref.Owner != 1 || !reflect.DeepEqual(ref.Items, []decodeID{2, 3}) || ref.Prev == nil || *ref.Prev != 4 {
+		t.Errorf("Unexpected result: %+v", ref)
+	}
+
+	err := evalOrFatal(t, ctx, `({Items: ["id-2", 3]})`).Decode(&ref)
+	if err == nil || !strings.HasPrefix(err.Error(), "Items[1]: ") {
+		t.Errorf("Expected an error at Items[1], got %v", err)
+	}
+
+	// Bind uses the same hooks both ways.
+	ctx.Bind("next", func(id decodeID) decodeID { return id + 1 })
+	if res, err := ctx.Eval(`next("id-41")`, NO_FILE); err != nil {
+		t.Fatal(err)
+	} else if res != "id-42" {
+		t.Errorf("Expected id-42, got %v", res)
+	}
+}
@@ -0,0 +1,169 @@
+package v8
+
+// #include "v8wrap.h"
+import "C"
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+)
+
+// DynamicObject is implemented by Go values backing the properties of JS
+// objects created with NewDynamicObject.  Properties are looked up in Go
+// each time a script touches them, so that large data sources need not be
+// converted up front.  Array indices are passed as decimal strings, so that
+// obj[42] and obj["42"] are the same property.
+//
+// The methods are called on the thread running the script, and may use the
+// context.
+type DynamicObject interface {
+	// Get returns the value of the named property: a *Value, or a Go value
+	// converted with ToValue, in which case a DynamicObject becomes another
+	// dynamic object.  If ok is false, the lookup continues on the
+	// prototype, e.g. for toString.  A non-nil error is thrown in JS.
+	Get(name string) (val interface{}, ok bool, err error)
+	// Set sets the named property.  val is released once Set returns; use
+	// ToValue(val) to keep a handle of its own.  A non-nil error is thrown in
+	// JS.
+	Set(name string, val *Value) error
+	// Has reports whether the object has the named property, for the in
+	// operator and Object.keys.
+	Has(name string) bool
+	// Delete deletes the named property, and reports whether it could.
+	Delete(name string) bool
+	// Keys returns the names of the properties, for enumeration.
+	Keys() []string
+}
+
+var dynamicObjectType = reflect.TypeOf((*DynamicObject)(nil)).Elem()
+
+// NewDynamicObject returns a JS object whose properties are all handled by
+// obj, through V8's property interceptors.  Unlike with a JS Proxy, scripts
+// cannot tell the object apart from an ordinary one.  obj is kept alive
+// until V8 collects the object.
+func (v *V8Context) NewDynamicObject(obj DynamicObject) (*Value, error) {
+	if obj == nil {
+		return nil, fmt.Errorf("Cannot create a dynamic object for nil")
+	}
+	var res *Value
+	var err error
+	v.exec(func() {
+		if v.v8context == nil {
+			err = ErrContextDestroyed
+			return
+		}
+		res, err = v.newDynamicObject(obj)
+	})
+	return res, err
+}
+
+// newDynamicObject is NewDynamicObject inside exec.
+func (v *V8Context) newDynamicObject(obj DynamicObject) (*Value, error) {
+	handle := v.addObject(obj)
+	ptr := C.v8_new_dynamic_object(v.v8context, C.double(handle))
+	if ptr == nil {
+		v.dropObject(handle)
+		return nil, fmt.Errorf("Cannot create a dynamic object for %T", obj)
+	}
+	return v.newValue(ptr), nil
+}
+
+//export _go_v8_property
+func _go_v8_property(
+	ctxID C.uint,
+	handle C.double,
+	op C.PropertyOp,
+	name C.String,
+	value C.PersistentValuePtr,
+	result *C.bool,
+	adopted *C.bool,
+	errmsg *C.String,
+) C.PersistentValuePtr {
+	contextsMutex.RLock()
+	ctx := contexts[uint(ctxID)]
+	contextsMutex.RUnlock()
+	if ctx == nil {
+		*errmsg = newCString(ErrContextDestroyed.Error())
+		return nil
+	}
+	ctx.objectsMu.Lock()
+	obj, _ := ctx.objects[uint64(handle)].(DynamicObject)
+	ctx.objectsMu.Unlock()
+	if obj == nil {
+		*errmsg = newCString(fmt.Sprintf("No such dynamic object: %v", handle))
+		return nil
+	}
+
+	*adopted = true
+	var val *Value
+	if value != nil {
+		val = ctx.newValue(value)
+		defer ctx.releaseValues(val)
+	}
+	res, err := ctx.dynamicProperty(obj, op, C.GoStringN(name.ptr, name.len), val, result)
+	if err == nil && res != nil {
+		err = res.checkIn(ctx)
+	}
+	if err != nil {
+		*errmsg = newCString(err.Error())
+		return nil
+	}
+	if res == nil {
+		return nil
+	}
+	return res.ptr
+}
+
+// dynamicProperty performs op for the interceptors of a dynamic object.
+func (v *V8Context) dynamicProperty(obj DynamicObject, op C.PropertyOp, name string, val *Value, result *C.bool) (*Value, error) {
+	switch op {
+	case C.PROPERTY_GET:
+		prop, ok, err := obj.Get(name)
+		if err != nil || !ok {
+			return nil, err
+		}
+		if res, isValue := prop.(*Value); isValue {
+			return res, nil
+		}
+		res, err := v.ToValue(prop)
+		if err != nil {
+			return nil, err
+		}
+		return v.releaseLater(res), nil
+	case C.PROPERTY_SET:
+		return nil, obj.Set(name, val)
+	case C.PROPERTY_QUERY:
+		*result = C.bool(obj.Has(name))
+	case C.PROPERTY_DELETE:
+		*result = C.bool(obj.Delete(name))
+	case C.PROPERTY_KEYS, C.PROPERTY_INDEX_KEYS:
+		names, indices := []string{}, []uint32{}
+		for _, key := range obj.Keys() {
+			if index, ok := arrayIndex(key); ok {
+				indices = append(indices, index)
+			} else {
+				names = append(names, key)
+			}
+		}
+		var keys interface{} = names
+		if op == C.PROPERTY_INDEX_KEYS {
+			keys = indices
+		}
+		res, err := v.ToValue(keys)
+		if err != nil {
+			return nil, err
+		}
+		return v.releaseLater(res), nil
+	}
+	return nil, nil
+}
+
+// arrayIndex returns the array index that key stands for, if any.
+func arrayIndex(key string) (uint32, bool) {
+	n, err := strconv.ParseUint(key, 10, 32)
+	if err != nil || n == 1<<32-1 || strconv.FormatUint(n, 10) != key {
+		return 0, false
+	}
+	return uint32(n), true
+}
@@ -0,0 +1,140 @@
+package v8
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// dynamicCustomers is a lazily loaded list of customers, counting the loads.
+type dynamicCustomers struct {
+	size  int
+	loads int
+}
+
+func (c *dynamicCustomers) Get(name string) (interface{}, bool, error) {
+	if name == "length" {
+		return c.size, true, nil
+	}
+	i, err := strconv.Atoi(name)
+	if err != nil || i < 0 || i >= c.size {
+		return nil, false, nil
+	}
+	c.loads++
+	return map[string]interface{}{"name": fmt.Sprintf("customer %d", i)}, true, nil
+}
+
+func (c *dynamicCustomers) Set(name string, val *Value) error {
+	return errors.New("customers are read-only")
+}
+
+func (c *dynamicCustomers) Has(name string) bool {
+	_, ok, _ := c.Get(name)
+	return ok
+}
+
+func (c *dynamicCustomers) Delete(name string) bool { return false }
+
+func (c *dynamicCustomers) Keys() []string {
+	var keys []string
+	for i := 0; i < c.size; i++ {
+		keys = append(keys, strconv.Itoa(i))
+	}
+	return keys
+}
+
+// dynamicMap is a writable dynamic object backed by a map.
+type dynamicMap map[string]interface{}
+
+func (m dynamicMap) Get(name string) (interface{}, bool, error) {
+	val, ok := m[name]
+	return val, ok, nil
+}
+
+func (m dynamicMap) Set(name string, val *Value) error {
+	var x interface{}
+	if err := val.Decode(&x); err != nil {
+		return err
+	}
+	m[name] = x
+	return nil
+}
+
+func (m dynamicMap) Has(name string) bool {
+	_, ok := m[name]
+	return ok
+}
+
+func (m dynamicMap) Delete(name string) bool {
+	delete(m, name)
+	return true
+}
+
+func (m dynamicMap) Keys() []string {
+	var keys []string
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestDynamicObjectLazyLoading(t *testing.T) {
+	ctx := NewContext()
+	customers := &dynamicCustomers{size: 1000000}
+	if err := ctx.SetGlobal("data", dynamicMap{"customers": customers}); err != nil {
+		t.Fatal(err)
+	}
+	res, err := ctx.Eval(`[data.customers[42].name, data.customers.length, 7 in data.customers, 2000000 in data.customers]`, NO_FILE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []interface{}{"customer 42", 1e6, true, false}
+	if !reflect.DeepEqual(res, expected) {
+		t.Errorf("Expected %v, got %v", expected, res)
+	}
+	if customers.loads != 2 {
+		t.Errorf("Expected only the touched customers to be loaded, got %d loads", customers.loads)
+	}
+
+	_, err = ctx.Eval(`data.customers[1] = {}`, NO_FILE)
+	if err == nil || !strings.Contains(err.Error(), "customers are read-only") {
+		t.Errorf("Expected the Go error to be thrown, got %v", err)
+	}
+}
+
+func TestDynamicObjectProperties(t *testing.T) {
+	ctx := NewContext()
+	m := dynamicMap{"b": 1.0, "2": "two"}
+	obj, err := ctx.NewDynamicObject(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ctx.SetGlobal("m", obj); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := ctx.Eval(`
+		m.a = [1, 2];
+		m[3] = "three";
+		delete m.b;
+		[Object.keys(m).join(), "a" in m, "b" in m, m[2], typeof m.toString, JSON.stringify(m)]`, NO_FILE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []interface{}{"2,3,a", true, false, "two", "function", `{"2":"two","3":"three","a":[1,2]}`}
+	if !reflect.DeepEqual(res, expected) {
+		t.Errorf("Expected %v, got %v", expected, res)
+	}
+	if !reflect.DeepEqual(m["a"], []interface{}{1.0, 2.0}) || m["3"] != "three" {
+		t.Errorf("Expected the assignments to reach Go, got %v", m)
+	}
+
+	if _, err := ctx.NewDynamicObject(nil); err == nil {
+		t.Error("Expected an error for a nil handler")
+	}
+}
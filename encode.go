@@ -0,0 +1,381 @@
+package v8
+
+// #include "v8wrap.h"
+import "C"
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+	"unsafe"
+)
+
+// Marshaler is implemented by types that convert themselves to JS values.
+// ToValue and everything built on it call ToJS instead of converting the
+// value by reflection, including for nested fields and elements.  The Value
+// ToJS returns is owned by the conversion, which releases it once stored,
+// so ToJS must return a new Value rather than one it keeps.
+type Marshaler interface {
+	ToJS(ctx *V8Context) (*Value, error)
+}
+
+// Unmarshaler is implemented by types that convert themselves from JS
+// values, the counterpart of Marshaler.  Value.Decode, Bind and Wrap's
+// setters call FromJS instead of converting the value by reflection.
+//
+// FromJS is not called for undefined.  val may be released once FromJS
+// returns; use ToValue(val) to keep a handle of its own.
+type Unmarshaler interface {
+	FromJS(val *Value) error
+}
+
+var (
+	marshalerType   = reflect.TypeOf((*Marshaler)(nil)).Elem()
+	unmarshalerType = reflect.TypeOf((*Unmarshaler)(nil)).Elem()
+	rawFunctionType = reflect.TypeOf(RawFunction(nil))
+	bigIntType      = reflect.TypeOf((*big.Int)(nil))
+)
+
+var errBigIntUnsupported = errors.New("BigInt is not supported by this version of V8")
+
+type encoder struct {
+	ctx *V8Context
+
+	// JS objects created for Go pointers and maps, so that shared
+	// references stay shared and cycles stay cycles.
+	seen map[encodedRef]*Value
+	// Values created while encoding, to release once the result is built.
+	temps []*Value
+}
+
+type encodedRef struct {
+	ptr uintptr
+	len int
+	typ reflect.Type
+}
+
+// toJS converts val to a new JS value.  It must be called inside exec.
+func (v *V8Context) toJS(val interface{}) (*Value, error) {
+	e := &encoder{ctx: v, seen: make(map[encodedRef]*Value)}
+	res, err := e.encode(reflect.ValueOf(val), "")
+	if err == nil && !e.created(res) {
+		// Always return a handle of our own, even for *Values passed in.
+		passed := res
+		res = v.newValue(C.v8_copy_persistent(v.v8context, passed.ptr))
+		runtime.KeepAlive(passed)
+	}
+	for _, temp := range e.temps {
+		if temp != res {
+			v.releaseValues(temp)
+		}
+	}
+	return res, err
+}
+
+func (e *encoder) created(val *Value) bool {
+	for _, temp := range e.temps {
+		if temp == val {
+			return true
+		}
+	}
+	return false
+}
+
+// newValue tracks a value created by the encoder.
+func (e *encoder) newValue(ptr C.PersistentValuePtr) *Value {
+	val := e.ctx.newValue(ptr)
+	e.temps = append(e.temps, val)
+	return val
+}
+
+func (e *encoder) encode(rv reflect.Value, path string) (*Value, error) {
+	v := e.ctx
+	fail := func(format string, args ...interface{}) error {
+		if path == "" {
+			return fmt.Errorf(format, args...)
+		}
+		return fmt.Errorf("%s: %s", path, fmt.Sprintf(format, args...))
+	}
+
+	if !rv.IsValid() {
+		return e.newValue(C.v8_new_null(v.v8context)), nil
+	}
+	t := rv.Type()
+	if nilable(rv) && rv.IsNil() {
+		return e.newValue(C.v8_new_null(v.v8context)), nil
+	}
+	if t.Kind() != reflect.Ptr && rv.CanAddr() {
+		// Like encoding/json, use methods with pointer receivers when
+		// possible.
+		if pt := reflect.PtrTo(t); pt.Implements(marshalerType) || pt.Implements(dynamicObjectType) ||
+			(pt.Implements(jsonMarshalerType) && !t.Implements(jsonMarshalerType)) {
+			return e.encode(rv.Addr(), path)
+		}
+	}
+
+	switch {
+	case t == valueType:
+		val := rv.Interface().(*Value)
+		if err := val.checkIn(v); err != nil {
+			return nil, fail("%v", err)
+		}
+		return val, nil
+	case t.Kind() == reflect.Ptr && t.Elem() == timeType:
+		// A *time.Time is a Date too, not the JSON of the time.
+		return e.encode(rv.Elem(), path)
+	case t.Kind() == reflect.Func && t.ConvertibleTo(rawFunctionType):
+		fn, err := v.CreateRawFunc(rv.Convert(rawFunctionType).Interface().(RawFunction))
+		if err != nil {
+			return nil, fail("%v", err)
+		}
+		e.temps = append(e.temps, fn)
+		return fn, nil
+	case t.Implements(marshalerType):
+		val, err := rv.Interface().(Marshaler).ToJS(v)
+		if err != nil {
+			return nil, fail("%v", err)
+		}
+		if val == nil {
+			return e.newValue(C.v8_new_undefined(v.v8context)), nil
+		}
+		if err := val.checkIn(v); err != nil {
+			return nil, fail("%v", err)
+		}
+		e.temps = append(e.temps, val)
+		return val, nil
+	case t.Implements(dynamicObjectType):
+		val, err := v.newDynamicObject(rv.Interface().(DynamicObject))
+		if err != nil {
+			return nil, fail("%v", err)
+		}
+		e.temps = append(e.temps, val)
+		return val, nil
+	case t == timeType:
+		tm := rv.Interface().(time.Time)
+		ms := float64(tm.Unix())*1e3 + float64(tm.Nanosecond())/1e6
+		return e.newValue(C.v8_new_date(v.v8context, C.double(ms))), nil
+	case t == bigIntType:
+		return e.bigInt(rv.Interface().(*big.Int), fail)
+	case t.Implements(jsonMarshalerType):
+		data, err := json.Marshal(rv.Interface())
+		if err != nil {
+			return nil, fail("%v", err)
+		}
+		val, err := v.FromJSON(string(data))
+		if err != nil {
+			return nil, fail("%v", err)
+		}
+		e.temps = append(e.temps, val)
+		return val, nil
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return e.newValue(C.v8_new_bool(v.v8context, C.bool(rv.Bool()))), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return e.newValue(C.v8_new_number(v.v8context, C.double(rv.Int()))), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return e.newValue(C.v8_new_number(v.v8context, C.double(rv.Uint()))), nil
+	case reflect.Float32, reflect.Float64:
+		return e.newValue(C.v8_new_number(v.v8context, C.double(rv.Float()))), nil
+	case reflect.String:
+		str := newCString(rv.String())
+		defer freeCString(str)
+		return e.newValue(C.v8_new_string(v.v8context, str)), nil
+
+	case reflect.Interface:
+		return e.encode(rv.Elem(), path)
+
+	case reflect.Ptr:
+		ref := encodedRef{ptr: rv.Pointer(), typ: t}
+		if val, ok := e.seen[ref]; ok {
+			return val, nil
+		}
+		if t.Elem().Kind() != reflect.Struct {
+			return e.encode(rv.Elem(), path)
+		}
+		obj := e.newValue(C.v8_new_object(v.v8context))
+		e.seen[ref] = obj
+		return obj, e.fields(obj, rv.Elem(), path)
+
+	case reflect.Struct:
+		obj := e.newValue(C.v8_new_object(v.v8context))
+		return obj, e.fields(obj, rv, path)
+
+	case reflect.Map:
+		ref := encodedRef{ptr: rv.Pointer(), typ: t}
+		if val, ok := e.seen[ref]; ok {
+			return val, nil
+		}
+		if t.Key().Kind() == reflect.String {
+			obj := e.newValue(C.v8_new_object(v.v8context))
+			e.seen[ref] = obj
+			keys := rv.MapKeys()
+			sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+			for _, key := range keys {
+				if err := e.set(obj, key.String(), rv.MapIndex(key), joinPath(path, key.String())); err != nil {
+					return nil, err
+				}
+			}
+			return obj, nil
+		}
+		m := e.newValue(C.v8_new_map(v.v8context))
+		e.seen[ref] = m
+		for _, key := range rv.MapKeys() {
+			k, err := e.encode(key, fmt.Sprintf("%s[%v]", path, key))
+			if err != nil {
+				return nil, err
+			}
+			item, err := e.encode(rv.MapIndex(key), fmt.Sprintf("%s[%v]", path, key))
+			if err != nil {
+				return nil, err
+			}
+			errmsg := C.v8_map_set(v.v8context, m.ptr, k.ptr, item.ptr)
+			runtime.KeepAlive(k)
+			runtime.KeepAlive(item)
+			if errmsg != nil {
+				return nil, fail("%s", C.GoString(errmsg))
+			}
+		}
+		return m, nil
+
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 && t.Kind() == reflect.Slice {
+			data := rv.Bytes()
+			var ptr *C.char
+			if len(data) > 0 {
+				ptr = (*C.char)(unsafe.Pointer(&data[0]))
+			}
+			return e.newValue(C.v8_new_uint8array(v.v8context, ptr, C.size_t(len(data)))), nil
+		}
+		// Like encoding/json, a slice is the same slice if it shares both
+		// its data and its length.
+		var ref encodedRef
+		if t.Kind() == reflect.Slice && rv.Len() > 0 {
+			ref = encodedRef{rv.Pointer(), rv.Len(), t}
+			if val, ok := e.seen[ref]; ok {
+				return val, nil
+			}
+		}
+		arr := e.newValue(C.v8_new_array(v.v8context, C.int(rv.Len())))
+		if ref.typ != nil {
+			e.seen[ref] = arr
+		}
+		for i := 0; i < rv.Len(); i++ {
+			item, err := e.encode(rv.Index(i), fmt.Sprintf("%s[%d]", path, i))
+			if err != nil {
+				return nil, err
+			}
+			errmsg := C.v8_set_index(v.v8context, arr.ptr, C.int(i), item.ptr)
+			runtime.KeepAlive(item)
+			if errmsg != nil {
+				return nil, fail("%s", C.GoString(errmsg))
+			}
+		}
+		return arr, nil
+	}
+	return nil, fail("cannot convert %v to JS", t)
+}
+
+// fields sets the exported fields of the struct rv on obj.
+func (e *encoder) fields(obj *Value, rv reflect.Value, path string) error {
+	for _, field := range wrapFields(rv.Type()) {
+		fv := rv.FieldByIndex(field.index)
+		if omitEmpty(rv.Type().FieldByIndex(field.index)) && isEmptyValue(fv) {
+			continue
+		}
+		if err := e.set(obj, field.name, fv, joinPath(path, field.name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *encoder) set(obj *Value, name string, rv reflect.Value, path string) error {
+	val, err := e.encode(rv, path)
+	if err != nil {
+		return err
+	}
+	cname := newCString(name)
+	defer freeCString(cname)
+	errmsg := C.v8_setPersistentField(e.ctx.v8context, obj.ptr, cname, val.ptr)
+	runtime.KeepAlive(obj)
+	runtime.KeepAlive(val)
+	if errmsg != nil {
+		return fmt.Errorf("%s: %s", path, C.GoString(errmsg))
+	}
+	return nil
+}
+
+func (e *encoder) bigInt(n *big.Int, fail func(string, ...interface{}) error) (*Value, error) {
+	// V8 wants 64-bit words, least significant first, like big.Int on
+	// 64-bit platforms.  Elsewhere, 32-bit words are packed in pairs.
+	bits := n.Bits()
+	perWord := int(8 / unsafe.Sizeof(big.Word(0)))
+	words := make([]C.uint64_t, (len(bits)+perWord-1)/perWord)
+	for i, word := range bits {
+		words[i/perWord] |= C.uint64_t(word) << (64 / uint(perWord) * uint(i%perWord))
+	}
+	var ptr *C.uint64_t
+	if len(words) > 0 {
+		ptr = &words[0]
+	}
+	sign := 0
+	if n.Sign() < 0 {
+		sign = 1
+	}
+	res := C.v8_new_bigint(e.ctx.v8context, C.int(sign), C.int(len(words)), ptr)
+	if res == nil {
+		return nil, fail("%v", errBigIntUnsupported)
+	}
+	return e.newValue(res), nil
+}
+
+func nilable(rv reflect.Value) bool {
+	switch rv.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Interface, reflect.Func, reflect.Chan:
+		return true
+	}
+	return false
+}
+
+// omitEmpty reports whether f has the omitempty option in its js or json
+// tag.
+func omitEmpty(f reflect.StructField) bool {
+	for _, key := range []string{"js", "json"} {
+		if tag, ok := f.Tag.Lookup(key); ok {
+			for _, opt := range strings.Split(tag, ",")[1:] {
+				if opt == "omitempty" {
+					return true
+				}
+			}
+			return false
+		}
+	}
+	return false
+}
+
+// isEmptyValue is the definition of empty used by encoding/json.
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
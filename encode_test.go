@@ -0,0 +1,131 @@
+package v8
+
+import (
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+type encodeNode struct {
+	Name  string      `json:"name"`
+	Note  string      `json:"note,omitempty"`
+	Next  *encodeNode `json:"next,omitempty"`
+	Other *encodeNode `json:"other,omitempty"`
+}
+
+type encodeCelsius float64
+
+func (c encodeCelsius) ToJS(ctx *V8Context) (*Value, error) {
+	return ctx.ToValue(map[string]interface{}{"celsius": float64(c), "unit": "C"})
+}
+
+// encodeBoth converts itself with ToJS rather than from its JSON.
+type encodeBoth struct{ N int }
+
+func (b encodeBoth) ToJS(ctx *V8Context) (*Value, error) {
+	return ctx.ToValue(map[string]interface{}{"n": b.N, "via": "ToJS"})
+}
+
+func (b encodeBoth) MarshalJSON() ([]byte, error) {
+	return []byte(`{"via":"JSON"}`), nil
+}
+
+type encodeFailing struct{}
+
+func (encodeFailing) ToJS(ctx *V8Context) (*Value, error) {
+	return nil, errors.New("cannot encode")
+}
+
+// checkJS sets val as a global named x and checks that js evaluates to true.
+func checkJS(t *testing.T, ctx *V8Context, val interface{}, js string) {
+	if err := ctx.SetGlobal("x", val); err != nil {
+		t.Fatal(err)
+	}
+	if res, err := ctx.Eval(js, NO_FILE); err != nil {
+		t.Errorf("%s: %v", js, err)
+	} else if res != true {
+		t.Errorf("%s: expected true, got %v", js, res)
+	}
+}
+
+func TestEncodeSharedReferences(t *testing.T) {
+	ctx := NewContext()
+	shared := &encodeNode{Name: "shared"}
+	checkJS(t, ctx, &encodeNode{Name: "root", Next: shared, Other: shared},
+		`x.next === x.other && x.next.name === "shared"`)
+
+	a := &encodeNode{Name: "a"}
+	a.Next = &encodeNode{Name: "b", Next: a}
+	checkJS(t, ctx, a, `x.next.next === x && x.next.name === "b"`)
+
+	m := map[string]interface{}{"k": 1}
+	checkJS(t, ctx, []interface{}{m, m}, `x[0] === x[1] && x[0].k === 1`)
+
+	s := []interface{}{"s", nil}
+	s[1] = s
+	checkJS(t, ctx, s, `x[1] === x && x[0] === "s"`)
+	checkJS(t, ctx, [][]interface{}{s, s[:1]}, `x[0] === x[0][1] && x[1] !== x[0] && x[1].length === 1`)
+}
+
+func TestEncodeTypes(t *testing.T) {
+	ctx := NewContext()
+	checkJS(t, ctx, map[int]string{1: "a", 2: "b"},
+		`x instanceof Map && x.get(1) === "a" && x.get(2) === "b"`)
+	checkJS(t, ctx, []byte{1, 2, 255},
+		`x instanceof Uint8Array && x.length === 3 && x[2] === 255`)
+	tm := time.Date(2020, 1, 2, 3, 4, 5, 6e6, time.UTC)
+	checkJS(t, ctx, tm,
+		`x instanceof Date && x.toISOString() === "2020-01-02T03:04:05.006Z"`)
+	checkJS(t, ctx, &tm,
+		`x instanceof Date && x.toISOString() === "2020-01-02T03:04:05.006Z"`)
+	checkJS(t, ctx, encodeNode{Name: "n"},
+		`Object.keys(x).join() === "name"`)
+	checkJS(t, ctx, map[string]interface{}{"b": nil, "a": []int{1, 2}},
+		`Object.keys(x).join() === "a,b" && x.b === null && x.a[1] === 2`)
+}
+
+func TestEncodeBigInt(t *testing.T) {
+	ctx := NewContext()
+	n, _ := new(big.Int).SetString("-123456789012345678901234567890", 10)
+	x, err := ctx.ToValue(n)
+	if err != nil && err.Error() == errBigIntUnsupported.Error() {
+		t.Skip(err)
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	ctx.ReleaseValue(x)
+	checkJS(t, ctx, n, `x === -123456789012345678901234567890n`)
+}
+
+func TestEncodeMarshaler(t *testing.T) {
+	ctx := NewContext()
+	checkJS(t, ctx, struct{ Temp encodeCelsius }{21.5},
+		`x.Temp.celsius === 21.5 && x.Temp.unit === "C"`)
+	both := encodeBoth{1}
+	checkJS(t, ctx, []interface{}{both, &both, struct{ B encodeBoth }{both}},
+		`x[0].via === "ToJS" && x[1].via === "ToJS" && x[2].B.n === 1`)
+
+	_, err := ctx.ToValue(map[string]interface{}{"a": []interface{}{encodeFailing{}}})
+	if err == nil || !strings.Contains(err.Error(), "a[0]: cannot encode") {
+		t.Errorf("Expected the error to name the failing path, got %v", err)
+	}
+}
+
+func TestEncodeReleasesTemporaries(t *testing.T) {
+	ctx := NewContext()
+	before := liveValues(ctx)
+	val, err := ctx.ToValue(map[string]interface{}{
+		"a": []int{1, 2, 3},
+		"b": &encodeNode{Name: "b"},
+		"c": []encodeCelsius{1, 2},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if live := liveValues(ctx); live != before+1 {
+		t.Errorf("Expected encoding to leave only the result live, got %d new values", live-before)
+	}
+	ctx.ReleaseValue(val)
+}
@@ -0,0 +1,102 @@
+package v8
+
+// #include <pthread.h>
+import "C"
+
+import "runtime"
+
+// executor owns a locked OS thread and runs every operation of an isolate on
+// it, in the order the operations were submitted.
+type executor struct {
+	ops    chan func()
+	thread C.pthread_t
+}
+
+// An operationPanic carries a panic raised on the executor thread back to the
+// goroutine that submitted the operation.
+type operationPanic struct {
+	value interface{}
+}
+
+func newExecutor() *executor {
+	e := &executor{ops: make(chan func())}
+	started := make(chan struct{})
+	go func() {
+		runtime.LockOSThread()
+		e.thread = C.pthread_self()
+		close(started)
+		e.serve(nil)
+	}()
+	<-started
+	return e
+}
+
+// serve runs submitted operations until the ops channel is closed or until
+// done is closed, whichever happens first.
+func (e *executor) serve(done chan struct{}) {
+	for {
+		select {
+		case op, ok := <-e.ops:
+			if !ok {
+				return
+			}
+			op()
+		case <-done:
+			return
+		}
+	}
+}
+
+// onThread reports whether the caller is running on the executor's thread,
+// e.g. inside a Go callback invoked from JS.
+func (e *executor) onThread() bool {
+	return C.pthread_equal(C.pthread_self(), e.thread) != 0
+}
+
+// run executes f on the executor thread and waits for it to complete.  Calls
+// made from the executor thread itself run inline, so that callbacks may call
+// back into the isolate without deadlocking.
+func (e *executor) run(f func()) {
+	if e.onThread() {
+		f()
+		return
+	}
+	done := make(chan *operationPanic)
+	e.ops <- func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- &operationPanic{r}
+				return
+			}
+			done <- nil
+		}()
+		f()
+	}
+	if p := <-done; p != nil {
+		panic(p.value)
+	}
+}
+
+// unlocked runs f on a separate goroutine while the executor thread keeps
+// serving operations that other goroutines submit to the (unlocked) isolate.
+func (e *executor) unlocked(f func()) {
+	done := make(chan struct{})
+	var p *operationPanic
+	go func() {
+		defer close(done)
+		defer func() {
+			if r := recover(); r != nil {
+				p = &operationPanic{r}
+			}
+		}()
+		f()
+	}()
+	e.serve(done)
+	if p != nil {
+		panic(p.value)
+	}
+}
+
+func (e *executor) stop() {
+	close(e.ops)
+}
@@ -0,0 +1,173 @@
+package v8
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestExecutorSharedContext(t *testing.T) {
+	ctx := NewContextInIsolate(NewIsolateWithExecutor())
+	if _, err := ctx.Eval(`var counter = 0; function inc(n) { counter += n; return counter; }`, NO_FILE); err != nil {
+		t.Fatal(err)
+	}
+
+	const N = 50
+	var wg sync.WaitGroup
+	errs := make(chan error, N)
+	for i := 0; i < N; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			val, err := ctx.EvalRaw(fmt.Sprintf(`({n:%d})`, i), NO_FILE)
+			if err != nil {
+				errs <- err
+				return
+			}
+			if _, err := val.ToJSON(); err != nil {
+				errs <- err
+				return
+			}
+			if _, err := ctx.Run("inc", 1); err != nil {
+				errs <- err
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	res, err := ctx.Eval(`counter`, NO_FILE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.(float64) != N {
+		t.Errorf("Expected counter to be %d, got %v", N, res)
+	}
+}
+
+func TestExecutorRecursiveCalls(t *testing.T) {
+	ctx := NewContextInIsolate(NewIsolateWithExecutor())
+	ctx.AddFunc("recurse", v8Recurse(ctx, t))
+	result, err := ctx.Run("recurse", 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != "xxxxxy" {
+		t.Fatalf("Got %v instead", result)
+	}
+}
+
+func TestExecutorUnlocked(t *testing.T) {
+	ctx := NewContextInIsolate(NewIsolateWithExecutor())
+
+	inside := make(chan struct{})
+	release := make(chan struct{})
+	ctx.AddFunc("wait", func(args ...interface{}) interface{} {
+		ctx.Unlocked(func() {
+			close(inside)
+			<-release
+		})
+		return "waited"
+	})
+
+	done := make(chan error)
+	go func() {
+		res, err := ctx.Eval(`wait()`, NO_FILE)
+		if err == nil && res != "waited" {
+			err = fmt.Errorf("Unexpected result %v", res)
+		}
+		done <- err
+	}()
+
+	<-inside
+	// The executor keeps serving other goroutines while wait() is unlocked.
+	if res, err := ctx.Eval(`1+2`, NO_FILE); err != nil {
+		t.Fatal(err)
+	} else if res.(float64) != 3 {
+		t.Errorf("Expected 3, got %v", res)
+	}
+	close(release)
+
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExecutorUnlockedInsideDo(t *testing.T) {
+	ctx := NewContextInIsolate(NewIsolateWithExecutor())
+	other := NewContextInIsolate(ctx.v8isolate)
+
+	err := ctx.Do(func(tx *Tx) error {
+		if _, err := tx.Eval(`var x = 1`, NO_FILE); err != nil {
+			return err
+		}
+		// Operations of other goroutines run on the executor thread while
+		// the Do callback is unlocked, and must lock the isolate themselves.
+		var res, otherRes interface{}
+		var err, otherErr error
+		ctx.Unlocked(func() {
+			res, err = ctx.Eval(`x + 1`, NO_FILE)
+			if err == nil {
+				err = ctx.Do(func(inner *Tx) error {
+					_, err := inner.Eval(`x = 2`, NO_FILE)
+					return err
+				})
+			}
+			otherRes, otherErr = other.Eval(`typeof x`, NO_FILE)
+		})
+		if err != nil || res != 2.0 {
+			return fmt.Errorf("Expected 2 while unlocked, got %v, %v", res, err)
+		}
+		if otherErr != nil || otherRes != "undefined" {
+			return fmt.Errorf("Expected undefined in the other context, got %v, %v", otherRes, otherErr)
+		}
+		res, err = tx.Eval(`x`, NO_FILE)
+		if err != nil || res != 2.0 {
+			return fmt.Errorf("Expected 2 after relocking, got %v, %v", res, err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res, err := ctx.Eval(`x + 1`, NO_FILE); err != nil || res != 3.0 {
+		t.Errorf("Expected 3 after Do, got %v, %v", res, err)
+	}
+}
+
+func TestExecutorPanicPropagates(t *testing.T) {
+	iso := NewIsolateWithExecutor()
+	defer func() {
+		if r := recover(); r != "boom" {
+			t.Errorf("Expected panic 'boom', got %v", r)
+		}
+	}()
+	iso.run(func() { panic("boom") })
+}
+
+func TestExecutorWithSnapshot(t *testing.T) {
+	iso, err := NewIsolateWithSnapshotAndExecutor(`var a = 1;`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := NewContextInIsolate(iso)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if res, err := ctx.Eval(`a`, NO_FILE); err != nil || res != 1.0 {
+				t.Errorf("Expected a == 1, got %v, %v", res, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if _, err := NewIsolateWithSnapshotAndExecutor(`this is bad js!!!!`); err == nil {
+		t.Error("Expected error with bad javascript")
+	}
+}
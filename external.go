@@ -0,0 +1,36 @@
+package v8
+
+// NewExternal returns an opaque JS object standing for x.  Scripts can store
+// and pass the object around but cannot look inside it; Go code gets x back
+// with Value.External.  x is kept alive until the JS object is garbage
+// collected.
+func (v *V8Context) NewExternal(x interface{}) (*Value, error) {
+	var res *Value
+	var err error
+	v.exec(func() {
+		if v.v8context == nil {
+			err = ErrContextDestroyed
+			return
+		}
+		res, err = v.newGoObject(x, nil)
+	})
+	return res, err
+}
+
+// External returns the Go value v stands for, if v was created by
+// NewExternal.  It also returns the Go values behind objects created by Wrap
+// and behind instances of classes defined with DefineClass.
+func (v *Value) External() (interface{}, bool) {
+	if v == nil || v.ctx == nil {
+		return nil, false
+	}
+	var res interface{}
+	var ok bool
+	v.ctx.exec(func() {
+		if v.check() != nil {
+			return
+		}
+		res, ok = v.ctx.goObject(v)
+	})
+	return res, ok
+}
@@ -0,0 +1,62 @@
+package v8
+
+import (
+	"os"
+	"testing"
+)
+
+func TestExternal(t *testing.T) {
+	ctx := NewContext()
+	file := os.Stdout
+	handle, err := ctx.NewExternal(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got interface{}
+	ctx.AddRawFunc("use", func(_ Loc, args ...*Value) (*Value, error) {
+		got, _ = args[0].External()
+		return nil, nil
+	})
+	store, err := ctx.CreateJS(`function(h) { this.saved = {h: h}; }`, NO_FILE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ctx.Apply(store, nil, handle); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ctx.Eval(`use(saved.h)`, NO_FILE); err != nil {
+		t.Fatal(err)
+	}
+	if got != file {
+		t.Errorf("Expected the same Go value back, got %#v", got)
+	}
+}
+
+func TestExternalOfPlainValue(t *testing.T) {
+	ctx := NewContext()
+	for _, js := range []string{`1`, `({})`, `"str"`} {
+		val, err := ctx.EvalRaw(js, NO_FILE)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if x, ok := val.External(); ok {
+			t.Errorf("%s: expected no Go value, got %#v", js, x)
+		}
+	}
+}
+
+func TestExternalReleased(t *testing.T) {
+	ctx := NewContext()
+	if _, err := ctx.NewExternal(&struct{}{}); err != nil {
+		t.Fatal(err)
+	}
+	if n := goObjects(ctx); n != 1 {
+		t.Fatalf("Expected 1 Go value, got %d", n)
+	}
+	ctx.ClearValues()
+	ctx.v8isolate.collectGarbage()
+	if n := goObjects(ctx); n != 0 {
+		t.Errorf("Expected the Go value to be released, %d remain", n)
+	}
+}
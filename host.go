@@ -0,0 +1,230 @@
+package v8
+
+// #include "v8wrap.h"
+import "C"
+
+import (
+	"fmt"
+	"reflect"
+	"runtime"
+	"unsafe"
+)
+
+// hostFunc implements a JS function created by newHostFunction.  this and
+// args are owned by the context like any other Value; construct is true when
+// the function was called with new.
+type hostFunc func(this *Value, args []*Value, construct bool) (*Value, error)
+
+//export _go_v8_host_call
+func _go_v8_host_call(
+	ctxID, callbackID C.uint,
+	self C.PersistentValuePtr,
+	argc C.int,
+	argvptr *C.PersistentValuePtr,
+	construct C.bool,
+	adopted *C.bool,
+	errmsg *C.String,
+) C.PersistentValuePtr {
+	contextsMutex.RLock()
+	ctx := contexts[uint(ctxID)]
+	contextsMutex.RUnlock()
+	if ctx == nil {
+		*errmsg = newCString(ErrContextDestroyed.Error())
+		return nil
+	}
+	ctx.hostFuncsMu.Lock()
+	function := ctx.hostFuncs[uint32(callbackID)]
+	ctx.hostFuncsMu.Unlock()
+	if function == nil {
+		*errmsg = newCString(fmt.Sprintf("No such host function: %d", callbackID))
+		return nil
+	}
+
+	var argv []C.PersistentValuePtr
+	sliceHeader := (*reflect.SliceHeader)((unsafe.Pointer(&argv)))
+	sliceHeader.Cap = int(argc)
+	sliceHeader.Len = int(argc)
+	sliceHeader.Data = uintptr(unsafe.Pointer(argvptr))
+
+	*adopted = true
+	this := ctx.newValue(self)
+	args := make([]*Value, argc)
+	for i := 0; i < int(argc); i++ {
+		args[i] = ctx.newValue(argv[i])
+	}
+
+	res, err := function(this, args, bool(construct))
+	if err == nil && res != nil {
+		err = res.checkIn(ctx)
+	}
+	if err != nil {
+		*errmsg = newCString(err.Error())
+		return nil
+	}
+	if res == nil {
+		return nil
+	}
+	return res.ptr
+}
+
+//export _go_v8_release_object
+func _go_v8_release_object(ctxID C.uint, handle C.double) {
+	contextsMutex.RLock()
+	ctx := contexts[uint(ctxID)]
+	contextsMutex.RUnlock()
+	if ctx == nil {
+		return
+	}
+	ctx.objectsMu.Lock()
+	delete(ctx.objects, uint64(handle))
+	ctx.objectsMu.Unlock()
+}
+
+//export _go_v8_release_host_function
+func _go_v8_release_host_function(ctxID C.uint, callbackID C.double) {
+	contextsMutex.RLock()
+	ctx := contexts[uint(ctxID)]
+	contextsMutex.RUnlock()
+	if ctx == nil {
+		return
+	}
+	id := uint32(callbackID)
+	ctx.hostFuncsMu.Lock()
+	defer ctx.hostFuncsMu.Unlock()
+	ctx.releasedHostFuncs++
+	if ctx.hostFuncRefs[id]--; ctx.hostFuncRefs[id] <= 0 {
+		delete(ctx.hostFuncRefs, id)
+		delete(ctx.hostFuncs, id)
+	}
+}
+
+// newHostFunction returns a JS function that calls f.  f is dropped once V8
+// collects the function.  It must be called inside exec.
+func (v *V8Context) newHostFunction(name string, f hostFunc) (*Value, error) {
+	return v.hostFunction(v.newHostFuncID(), name, f)
+}
+
+// newHostFuncID returns an unused host function ID.
+func (v *V8Context) newHostFuncID() uint32 {
+	v.hostFuncsMu.Lock()
+	defer v.hostFuncsMu.Unlock()
+	v.nextHostFunc++
+	return v.nextHostFunc
+}
+
+// hostFunction returns a new JS function that calls the host function id,
+// which it sets to f.  It must be called inside exec.
+func (v *V8Context) hostFunction(id uint32, name string, f hostFunc) (*Value, error) {
+	cname := newCString(name)
+	defer freeCString(cname)
+	ptr := C.v8_new_host_function(v.v8context, C.uint(id), cname)
+	if ptr == nil {
+		return nil, fmt.Errorf("Cannot create function %s", name)
+	}
+	v.hostFuncsMu.Lock()
+	v.hostFuncs[id] = f
+	v.hostFuncRefs[id]++
+	v.hostFuncsMu.Unlock()
+	return v.newValue(ptr), nil
+}
+
+// addGlobalFunction defines a global JS function named name that calls f.
+// Defining name again reuses its host function, so that functions previously
+// bound to name call f too.
+func (v *V8Context) addGlobalFunction(name string, f hostFunc) error {
+	var err error
+	v.exec(func() {
+		if v.v8context == nil {
+			err = ErrContextDestroyed
+			return
+		}
+		v.hostFuncsMu.Lock()
+		id, ok := v.globalFuncs[name]
+		if !ok {
+			v.nextHostFunc++
+			id = v.nextHostFunc
+			v.globalFuncs[name] = id
+		}
+		v.hostFuncsMu.Unlock()
+		var fn *Value
+		if fn, err = v.hostFunction(id, name, f); err != nil {
+			return
+		}
+		defer v.releaseValues(fn)
+		err = v.SetGlobal(name, fn)
+	})
+	return err
+}
+
+// newGoObject returns a JS object standing for obj, with proto as its
+// prototype unless proto is nil.  obj is kept alive until V8 collects the
+// object.  It must be called inside exec.
+func (v *V8Context) newGoObject(obj interface{}, proto C.PersistentValuePtr) (*Value, error) {
+	handle := v.addObject(obj)
+	ptr := C.v8_new_go_object(v.v8context, C.double(handle), proto)
+	if ptr == nil {
+		v.dropObject(handle)
+		return nil, fmt.Errorf("Cannot create an object for %T", obj)
+	}
+	return v.newValue(ptr), nil
+}
+
+// addObject returns a new handle for obj.
+func (v *V8Context) addObject(obj interface{}) uint64 {
+	v.objectsMu.Lock()
+	defer v.objectsMu.Unlock()
+	v.nextObject++
+	v.objects[v.nextObject] = obj
+	return v.nextObject
+}
+
+func (v *V8Context) dropObject(handle uint64) {
+	v.objectsMu.Lock()
+	delete(v.objects, handle)
+	v.objectsMu.Unlock()
+}
+
+// goObjectEntry returns what the handle of val refers to, if val stands for a
+// Go value.  It must be called inside exec.
+func (v *V8Context) goObjectEntry(val *Value) (interface{}, bool) {
+	handle := uint64(C.v8_go_object_handle(v.v8context, val.ptr))
+	runtime.KeepAlive(val)
+	if handle == 0 {
+		return nil, false
+	}
+	v.objectsMu.Lock()
+	defer v.objectsMu.Unlock()
+	obj, ok := v.objects[handle]
+	return obj, ok
+}
+
+// goObject returns the Go value val stands for, if any.  It must be called
+// inside exec.
+func (v *V8Context) goObject(val *Value) (interface{}, bool) {
+	obj, ok := v.goObjectEntry(val)
+	if inst, isInstance := obj.(*classInstance); isInstance {
+		return inst.obj, true
+	}
+	return obj, ok
+}
+
+// releaseLater releases val at the start of the next operation on the
+// context.  Host functions use it for results created only to be returned to
+// JS, which must outlive the call.
+func (v *V8Context) releaseLater(val *Value) *Value {
+	v.valuesMu.Lock()
+	v.finalized = append(v.finalized, val.persistent)
+	v.valuesMu.Unlock()
+	return val
+}
+
+// releaseValues releases vals right away.  It must be called inside exec.
+func (v *V8Context) releaseValues(vals ...*Value) {
+	v.valuesMu.Lock()
+	defer v.valuesMu.Unlock()
+	for _, val := range vals {
+		if val != nil && val.ptr != nil {
+			v.releaseLocked(val.persistent)
+		}
+	}
+}
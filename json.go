@@ -0,0 +1,128 @@
+package v8
+
+// #include <stdlib.h>
+// #include "v8wrap.h"
+import "C"
+
+import (
+	"errors"
+	"runtime"
+	"unsafe"
+)
+
+// JSONOptions controls how MarshalJSONWith converts a value to JSON, beyond
+// what JSON.stringify does.
+type JSONOptions struct {
+	// Indent is repeated once per nesting level to indent nested values,
+	// like the space argument of JSON.stringify.  Only its first 10
+	// characters are used.
+	Indent string
+	// Fields, unless nil, lists the only object fields to keep, like an
+	// array replacer of JSON.stringify.
+	Fields []string
+	// BreakCycles replaces references to an object from within itself by
+	// the string CyclePlaceholder, instead of failing.
+	BreakCycles      bool
+	CyclePlaceholder string
+	// BigIntAsString converts BigInts to strings of decimal digits, instead
+	// of failing.
+	BigIntAsString bool
+}
+
+// MarshalJSON implements json.Marshaler, converting the value like
+// JSON.stringify would.  Values that have no JSON representation, such as
+// undefined or functions, give null.
+func (v *Value) MarshalJSON() ([]byte, error) {
+	return v.MarshalJSONWith(JSONOptions{})
+}
+
+// MarshalJSONWith is like MarshalJSON, with the given options.
+func (v *Value) MarshalJSONWith(opts JSONOptions) ([]byte, error) {
+	res, err := v.toJSON(&opts)
+	if err != nil {
+		return nil, err
+	}
+	if res == "undefined" {
+		res = "null"
+	}
+	return []byte(res), nil
+}
+
+// toJSON converts the value to JSON without going through the global JSON
+// object, which scripts may replace.  opts may be nil.
+func (v *Value) toJSON(opts *JSONOptions) (res string, err error) {
+	if v == nil {
+		return "", ErrNilValue
+	}
+	if v.ctx == nil {
+		return "", ErrContextDestroyed
+	}
+	var copts *C.JSONOptions
+	if opts != nil {
+		copts = &C.JSONOptions{
+			indent:            newCString(opts.Indent),
+			fields_len:        -1,
+			break_cycles:      C.bool(opts.BreakCycles),
+			cycle_placeholder: newCString(opts.CyclePlaceholder),
+			bigint_as_string:  C.bool(opts.BigIntAsString),
+		}
+		defer freeCString(copts.indent)
+		defer freeCString(copts.cycle_placeholder)
+		if opts.Fields != nil {
+			// Always allocate at least one so that fields is not NULL.
+			size := C.size_t(len(opts.Fields)+1) * C.size_t(unsafe.Sizeof(C.String{}))
+			copts.fields = (*C.String)(C.malloc(size))
+			defer C.free(unsafe.Pointer(copts.fields))
+			fields := (*[1 << 24]C.String)(unsafe.Pointer(copts.fields))[:len(opts.Fields):len(opts.Fields)]
+			for i, field := range opts.Fields {
+				fields[i] = newCString(field)
+				defer freeCString(fields[i])
+			}
+			copts.fields_len = C.int(len(opts.Fields))
+		}
+	}
+
+	v.ctx.exec(func() {
+		if err = v.check(); err != nil {
+			return
+		}
+		str := C.v8_to_json(v.ctx.v8context, v.ptr, copts)
+		runtime.KeepAlive(v)
+		if str.ptr == nil {
+			if C.v8_context_has_terminated(v.ctx.v8context) {
+				err = ErrTerminated
+				return
+			}
+			err = errors.New(takeCString(C.v8_error(v.ctx.v8context)))
+			return
+		}
+		res = takeCString(str)
+	})
+	return res, err
+}
+
+// ParseJSON parses JSON data and returns a Value that references the parsed
+// data in the V8 context, like JSON.parse would.
+func (v *V8Context) ParseJSON(data []byte) (*Value, error) {
+	cdata := C.String{ptr: (*C.char)(C.CBytes(data)), len: C.int(len(data))}
+	defer freeCString(cdata)
+	var res *Value
+	var err error
+	v.exec(func() {
+		if v.v8context == nil {
+			err = ErrContextDestroyed
+			return
+		}
+		ptr := C.v8_parse_json(v.v8context, cdata)
+		if ptr == nil {
+			if C.v8_context_has_terminated(v.v8context) {
+				err = ErrTerminated
+				return
+			}
+			err = errors.New(takeCString(C.v8_error(v.v8context)))
+			return
+		}
+		res = v.newValue(ptr)
+	})
+	return res, err
+}
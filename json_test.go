@@ -0,0 +1,88 @@
+package v8
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestJSONWithoutGlobalJSON(t *testing.T) {
+	ctx := NewContext()
+	if _, err := ctx.Eval(`JSON = {parse: null, stringify: null}`, NO_FILE); err != nil {
+		t.Fatal(err)
+	}
+
+	val, err := ctx.ParseJSON([]byte(`{"a": [1, "x\u0000"], "b": null}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if json := toJsonOrFatal(val, t); json != `{"a":[1,"x\u0000"],"b":null}` {
+		t.Errorf("Unexpected JSON: %s", json)
+	}
+	if res, err := ctx.Eval(`({n: 1})`, NO_FILE); err != nil {
+		t.Fatal(err)
+	} else if m, ok := res.(map[string]interface{}); !ok || m["n"] != 1.0 {
+		t.Errorf("Expected Eval to still convert its result, got %v", res)
+	}
+
+	if _, err := ctx.ParseJSON([]byte(`{"a": `)); err == nil {
+		t.Error("Expected an error for invalid JSON")
+	}
+}
+
+func TestMarshalJSONWith(t *testing.T) {
+	ctx := NewContext()
+	val := evalOrFatal(t, ctx, `var o = {a: 1, b: {a: 2, c: 3}, d: new Date(0)}; o.b.self = o; o`)
+
+	if _, err := val.MarshalJSON(); err == nil || !strings.Contains(err.Error(), "circular") {
+		t.Errorf("Expected a circular structure error, got %v", err)
+	}
+
+	for _, test := range []struct {
+		opts     JSONOptions
+		expected string
+	}{
+		{JSONOptions{BreakCycles: true, CyclePlaceholder: "[cycle]"},
+			`{"a":1,"b":{"a":2,"c":3,"self":"[cycle]"},"d":"1970-01-01T00:00:00.000Z"}`},
+		{JSONOptions{Fields: []string{"a", "b"}},
+			`{"a":1,"b":{"a":2}}`},
+		{JSONOptions{Fields: []string{}}, `{}`},
+		{JSONOptions{Fields: []string{"b", "c"}, Indent: "\t"},
+			"{\n\t\"b\": {\n\t\t\"c\": 3\n\t}\n}"},
+	} {
+		res, err := val.MarshalJSONWith(test.opts)
+		if err != nil {
+			t.Errorf("%+v: %v", test.opts, err)
+		} else if string(res) != test.expected {
+			t.Errorf("%+v: expected %s, got %s", test.opts, test.expected, res)
+		}
+	}
+
+	if res, err := evalOrFatal(t, ctx, `undefined`).MarshalJSON(); err != nil || string(res) != "null" {
+		t.Errorf("Expected null for undefined, got %s, %v", res, err)
+	}
+
+	big, err := ctx.EvalRaw(`({n: BigInt("123456789012345678901234567890")})`, NO_FILE)
+	if err != nil {
+		t.Skip("BigInts are not supported:", err)
+	}
+	if _, err := big.MarshalJSON(); err == nil {
+		t.Error("Expected an error for a BigInt")
+	}
+	if res, err := big.MarshalJSONWith(JSONOptions{BigIntAsString: true}); err != nil || string(res) != `{"n":"123456789012345678901234567890"}` {
+		t.Errorf("Expected the BigInt as a string, got %s, %v", res, err)
+	}
+}
+
+func TestValueMarshaler(t *testing.T) {
+	ctx := NewContext()
+	data, err := json.Marshal(map[string]interface{}{
+		"js": evalOrFatal(t, ctx, `({list: [1, "two"], f: function() {}})`),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"js":{"list":[1,"two"]}}` {
+		t.Errorf("Unexpected JSON: %s", data)
+	}
+}
@@ -0,0 +1,323 @@
+package v8
+
+// #include "v8wrap.h"
+import "C"
+
+import (
+	"errors"
+	"reflect"
+	"runtime"
+)
+
+// KeyOptions selects the properties that Keys and Entries return.  By default
+// they return the object's own enumerable properties keyed by strings, like
+// Object.keys.
+type KeyOptions struct {
+	// Inherited includes the properties of the prototype chain, after the
+	// object's own.
+	Inherited bool
+	// Symbols includes the properties keyed by symbols.
+	Symbols bool
+	// NonEnumerable includes the properties that are not enumerable.
+	NonEnumerable bool
+}
+
+func (opts KeyOptions) flags() C.int {
+	var flags C.int
+	if opts.Inherited {
+		flags |= C.KEYS_INHERITED
+	}
+	if opts.Symbols {
+		flags |= C.KEYS_SYMBOLS
+	}
+	if opts.NonEnumerable {
+		flags |= C.KEYS_NON_ENUMERABLE
+	}
+	return flags
+}
+
+// Property is a property of a JS object.
+type Property struct {
+	// Key holds a string, or a symbol.
+	Key, Value *Value
+}
+
+// Keys returns the keys of the object held by v, in property order: integer
+// indices first, then strings and then symbols in the order they were added.
+// Integer indices are returned as strings.
+func (v *Value) Keys(opts KeyOptions) ([]*Value, error) {
+	var res []*Value
+	err := v.properties(opts, false, func(items []*Value) {
+		res = items
+	})
+	return res, err
+}
+
+// Entries returns the keys and values of the object held by v, in the order
+// of Keys.
+func (v *Value) Entries(opts KeyOptions) ([]Property, error) {
+	var res []Property
+	err := v.properties(opts, true, func(items []*Value) {
+		res = make([]Property, 0, len(items)/2)
+		for i := 0; i+1 < len(items); i += 2 {
+			res = append(res, Property{items[i], items[i+1]})
+		}
+	})
+	return res, err
+}
+
+// properties passes the items of v8_properties to f.
+func (v *Value) properties(opts KeyOptions, values bool, f func(items []*Value)) error {
+	if v == nil {
+		return ErrNilValue
+	}
+	if v.ctx == nil {
+		return ErrContextDestroyed
+	}
+	var err error
+	v.ctx.exec(func() {
+		if err = v.check(); err != nil {
+			return
+		}
+		ptr := C.v8_properties(v.ctx.v8context, v.ptr, opts.flags(), C.bool(values))
+		runtime.KeepAlive(v)
+		if ptr == nil {
+			if C.v8_context_has_terminated(v.ctx.v8context) {
+				err = ErrTerminated
+				return
+			}
+			err = errors.New(takeCString(C.v8_error(v.ctx.v8context)))
+			return
+		}
+		var items []*Value
+		if items, err = v.ctx.arrayItems(ptr); err == nil {
+			f(items)
+		}
+	})
+	return err
+}
+
+// PropertyDescriptor describes a property, like the descriptors of
+// Object.defineProperty.  A property either holds a Value, or has accessors
+// Get and Set.  Fields left nil are absent from the descriptor: like in JS,
+// they keep their current setting when changing a property, and default to
+// undefined or false when defining a new one.
+type PropertyDescriptor struct {
+	// Value is the value of a data property: a *Value, or a Go value
+	// converted with ToValue.  Use a *Value holding undefined to set the
+	// value to undefined.
+	Value interface{}
+	// Get and Set are the accessors of an accessor property: *Values
+	// holding JS functions, or Go functions converted like Bind does.  The
+	// getter is called with no argument, and the setter with the new value.
+	Get, Set interface{}
+	// Writable only applies to data properties.
+	Writable, Enumerable, Configurable *bool
+}
+
+// DefineProperty defines the named property of the object held by v, or
+// changes its attributes, like Object.defineProperty.
+func (v *Value) DefineProperty(name string, desc PropertyDescriptor) error {
+	if v == nil {
+		return ErrNilValue
+	}
+	if v.ctx == nil {
+		return ErrContextDestroyed
+	}
+	if (desc.Get != nil || desc.Set != nil) && (desc.Value != nil || desc.Writable != nil) {
+		return errors.New("Invalid property descriptor. Cannot both specify accessors and a value or writable attribute")
+	}
+	ctx := v.ctx
+	cname := newCString(name)
+	defer freeCString(cname)
+	var err error
+	ctx.exec(func() {
+		if err = v.check(); err != nil {
+			return
+		}
+		var cdesc C.PropertyDesc
+		if desc.Writable != nil {
+			cdesc.has_writable, cdesc.writable = true, C.bool(*desc.Writable)
+		}
+		if desc.Enumerable != nil {
+			cdesc.has_enumerable, cdesc.enumerable = true, C.bool(*desc.Enumerable)
+		}
+		if desc.Configurable != nil {
+			cdesc.has_configurable, cdesc.configurable = true, C.bool(*desc.Configurable)
+		}
+		if desc.Value != nil {
+			var val *Value
+			if val, err = ctx.toJS(desc.Value); err != nil {
+				return
+			}
+			defer ctx.releaseValues(val)
+			cdesc.value = val.ptr
+		}
+		if desc.Get != nil {
+			var get *Value
+			if get, err = ctx.accessor(name, desc.Get); err != nil {
+				return
+			}
+			defer ctx.releaseValues(get)
+			cdesc.get = get.ptr
+		}
+		if desc.Set != nil {
+			var set *Value
+			if set, err = ctx.accessor(name, desc.Set); err != nil {
+				return
+			}
+			defer ctx.releaseValues(set)
+			cdesc.set = set.ptr
+		}
+		ok := C.v8_define_property(ctx.v8context, v.ptr, cname, &cdesc)
+		runtime.KeepAlive(v)
+		if !ok {
+			if C.v8_context_has_terminated(ctx.v8context) {
+				err = ErrTerminated
+				return
+			}
+			err = errors.New(takeCString(C.v8_error(ctx.v8context)))
+		}
+	})
+	return err
+}
+
+// accessor converts a getter or setter of a PropertyDescriptor to a JS
+// function.  It must be called inside exec.
+func (v *V8Context) accessor(name string, fn interface{}) (*Value, error) {
+	if t := reflect.TypeOf(fn); t.Kind() == reflect.Func && !t.ConvertibleTo(rawFunctionType) {
+		f, err := v.boundFunction(name, fn)
+		if err != nil {
+			return nil, err
+		}
+		return v.newHostFunction(name, f)
+	}
+	val, err := v.toJS(fn)
+	if err != nil {
+		return nil, err
+	}
+	if kind := v.kind(val); kind != C.VALUE_FUNCTION {
+		v.releaseValues(val)
+		return nil, &NotCallableError{Kind: kindNames[kind]}
+	}
+	return val, nil
+}
+
+// GetOwnPropertyDescriptor returns the descriptor of the named own property
+// of the object held by v, or nil if there is no such property.  Value, Get
+// and Set hold *Values; Writable is nil for accessor properties.
+func (v *Value) GetOwnPropertyDescriptor(name string) (*PropertyDescriptor, error) {
+	if v == nil {
+		return nil, ErrNilValue
+	}
+	if v.ctx == nil {
+		return nil, ErrContextDestroyed
+	}
+	ctx := v.ctx
+	cname := newCString(name)
+	defer freeCString(cname)
+	var res *PropertyDescriptor
+	var err error
+	ctx.exec(func() {
+		if err = v.check(); err != nil {
+			return
+		}
+		ptr := C.v8_get_own_property_descriptor(ctx.v8context, v.ptr, cname)
+		runtime.KeepAlive(v)
+		if ptr == nil {
+			if C.v8_context_has_terminated(ctx.v8context) {
+				err = ErrTerminated
+				return
+			}
+			err = errors.New(takeCString(C.v8_error(ctx.v8context)))
+			return
+		}
+		desc := ctx.newValue(ptr)
+		defer ctx.releaseValues(desc)
+		if ctx.kind(desc) == C.VALUE_UNDEFINED {
+			return
+		}
+		var fields []Property
+		if fields, err = desc.Entries(KeyOptions{}); err != nil {
+			return
+		}
+		res = &PropertyDescriptor{}
+		for _, field := range fields {
+			key, _ := field.Key.ToString()
+			ctx.releaseValues(field.Key)
+			switch key {
+			case "value":
+				res.Value = field.Value
+				continue
+			case "get", "set":
+				if ctx.kind(field.Value) == C.VALUE_FUNCTION {
+					if key == "get" {
+						res.Get = field.Value
+					} else {
+						res.Set = field.Value
+					}
+					continue
+				}
+			case "writable":
+				res.Writable = ctx.boolField(field.Value)
+			case "enumerable":
+				res.Enumerable = ctx.boolField(field.Value)
+			case "configurable":
+				res.Configurable = ctx.boolField(field.Value)
+			}
+			ctx.releaseValues(field.Value)
+		}
+	})
+	return res, err
+}
+
+// boolField returns the boolean held by a field of a property descriptor.
+// It must be called inside exec.
+func (v *V8Context) boolField(val *Value) *bool {
+	b := bool(C.v8_value_bool(v.v8context, val.ptr))
+	runtime.KeepAlive(val)
+	return &b
+}
+
+// PreventExtensions prevents new properties from being added to the object
+// held by v, like Object.preventExtensions.
+func (v *Value) PreventExtensions() error {
+	return v.setIntegrity(C.INTEGRITY_PREVENT_EXTENSIONS)
+}
+
+// Seal prevents properties from being added to or removed from the object
+// held by v, like Object.seal.
+func (v *Value) Seal() error {
+	return v.setIntegrity(C.INTEGRITY_SEALED)
+}
+
+// Freeze prevents any change to the properties of the object held by v, like
+// Object.freeze.  Like Object.freeze, it is shallow.
+func (v *Value) Freeze() error {
+	return v.setIntegrity(C.INTEGRITY_FROZEN)
+}
+
+func (v *Value) setIntegrity(level C.Integrity) error {
+	if v == nil {
+		return ErrNilValue
+	}
+	if v.ctx == nil {
+		return ErrContextDestroyed
+	}
+	var err error
+	v.ctx.exec(func() {
+		if err = v.check(); err != nil {
+			return
+		}
+		ok := C.v8_set_integrity(v.ctx.v8context, v.ptr, level)
+		runtime.KeepAlive(v)
+		if !ok {
+			if C.v8_context_has_terminated(v.ctx.v8context) {
+				err = ErrTerminated
+				return
+			}
+			err = errors.New(takeCString(C.v8_error(v.ctx.v8context)))
+		}
+	})
+	return err
+}
@@ -0,0 +1,232 @@
+package v8
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// keyNames returns String(key) for each key, joined with commas.
+func keyNames(t *testing.T, ctx *V8Context, keys []*Value) string {
+	toString := evalOrFatal(t, ctx, `String`)
+	var names []string
+	for _, key := range keys {
+		res, err := toString.Call(nil, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		name, err := res.ToString()
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, name)
+	}
+	return strings.Join(names, ",")
+}
+
+func TestKeys(t *testing.T) {
+	ctx := NewContext()
+	obj := evalOrFatal(t, ctx, `
+		var proto = {inherited: 1};
+		var o = Object.create(proto);
+		o.zebra = 1;
+		o[Symbol("sym")] = 2;
+		o.apple = 3;
+		o[2] = 4;
+		o[1] = 5;
+		Object.defineProperty(o, "hidden", {value: 6, enumerable: false});
+		o`)
+
+	for _, test := range []struct {
+		opts     KeyOptions
+		expected string
+	}{
+		{KeyOptions{}, "1,2,zebra,apple"},
+		{KeyOptions{Symbols: true}, "1,2,zebra,apple,Symbol(sym)"},
+		{KeyOptions{NonEnumerable: true}, "1,2,zebra,apple,hidden"},
+		{KeyOptions{Inherited: true}, "1,2,zebra,apple,inherited"},
+	} {
+		keys, err := obj.Keys(test.opts)
+		if err != nil {
+			t.Errorf("%+v: %v", test.opts, err)
+		} else if names := keyNames(t, ctx, keys); names != test.expected {
+			t.Errorf("%+v: expected %s, got %s", test.opts, test.expected, names)
+		}
+	}
+
+	if _, err := evalOrFatal(t, ctx, `"str"`).Keys(KeyOptions{}); err == nil {
+		t.Error("Expected an error for a primitive")
+	}
+}
+
+func TestEntries(t *testing.T) {
+	ctx := NewContext()
+	obj := evalOrFatal(t, ctx, `var s = Symbol("s"); ({b: "x", a: "y", [s]: "z", get c() { return "w"; }})`)
+	entries, err := obj.Entries(KeyOptions{Symbols: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys, values []*Value
+	for _, entry := range entries {
+		keys = append(keys, entry.Key)
+		values = append(values, entry.Value)
+	}
+	if names := keyNames(t, ctx, keys); names != "b,a,c,Symbol(s)" {
+		t.Errorf("Unexpected keys: %s", names)
+	}
+	if names := keyNames(t, ctx, values); names != "x,y,w,z" {
+		t.Errorf("Unexpected values: %s", names)
+	}
+
+	failing := evalOrFatal(t, ctx, `({get f() { throw new Error("getter failed"); }})`)
+	if _, err := failing.Entries(KeyOptions{}); err == nil || !strings.Contains(err.Error(), "getter failed") {
+		t.Errorf("Expected the getter's error, got %v", err)
+	}
+}
+
+func TestDefineProperty(t *testing.T) {
+	ctx := NewContext()
+	config := evalOrFatal(t, ctx, `var config = {}; config`)
+	yes, no := true, false
+	if err := config.DefineProperty("mode", PropertyDescriptor{Value: "prod", Enumerable: &yes}); err != nil {
+		t.Fatal(err)
+	}
+	calls := 0
+	if err := config.DefineProperty("lazy", PropertyDescriptor{
+		Get: func() []int { calls++; return []int{1, 2} },
+	}); err != nil {
+		t.Fatal(err)
+	}
+	var saved string
+	if err := config.DefineProperty("name", PropertyDescriptor{
+		Get:          evalOrFatal(t, ctx, `(function() { return "js getter"; })`),
+		Set:          func(s string) { saved = s },
+		Configurable: &yes,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := ctx.Eval(`"use strict";
+		var failed = false;
+		try { config.mode = "dev"; } catch (e) { failed = true; }
+		config.name = "set from js";
+		[config.mode, failed, config.lazy[1], config.lazy.length, config.name, Object.keys(config).join()]`, NO_FILE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []interface{}{"prod", true, 2.0, 2.0, "js getter", "mode"}
+	if !reflect.DeepEqual(res, expected) {
+		t.Errorf("Expected %v, got %v", expected, res)
+	}
+	if calls != 2 || saved != "set from js" {
+		t.Errorf("Expected the Go accessors to be called, got %d calls and %q", calls, saved)
+	}
+
+	if err := config.DefineProperty("mode", PropertyDescriptor{Value: "dev"}); err == nil || !strings.Contains(err.Error(), "Cannot redefine property: mode") {
+		t.Errorf("Expected an error redefining a non-configurable property, got %v", err)
+	}
+	if err := config.DefineProperty("x", PropertyDescriptor{Value: 1, Get: func() int { return 1 }}); err == nil {
+		t.Error("Expected an error for a value with accessors")
+	}
+	if err := config.DefineProperty("x", PropertyDescriptor{Get: 1}); err == nil {
+		t.Error("Expected an error for a getter that is not a function")
+	}
+
+	// Defining one accessor keeps the other.
+	if err := config.DefineProperty("name", PropertyDescriptor{
+		Get: func() string { return "go getter" },
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if res, err := ctx.Eval(`config.name = "set again"; config.name`, NO_FILE); err != nil || res != "go getter" || saved != "set again" {
+		t.Errorf("Expected both accessors to work, got %v, %q (err: %v)", res, saved, err)
+	}
+
+	// Changing attributes keeps the value and the other attributes.
+	obj := evalOrFatal(t, ctx, `var obj = {a: 1}; obj`)
+	if err := obj.DefineProperty("a", PropertyDescriptor{Enumerable: &no}); err != nil {
+		t.Fatal(err)
+	}
+	if err := obj.DefineProperty("a", PropertyDescriptor{Writable: &no}); err != nil {
+		t.Fatal(err)
+	}
+	res, err = ctx.Eval(`obj.a = 2; var d = Object.getOwnPropertyDescriptor(obj, "a");
+		[d.value, d.writable, d.enumerable, d.configurable]`, NO_FILE)
+	if expected := []interface{}{1.0, false, false, true}; err != nil || !reflect.DeepEqual(res, expected) {
+		t.Errorf("Expected %v, got %v (err: %v)", expected, res, err)
+	}
+}
+
+func TestGetOwnPropertyDescriptor(t *testing.T) {
+	ctx := NewContext()
+	obj := evalOrFatal(t, ctx, `({a: 1, get b() { return 2; }})`)
+
+	desc, err := obj.GetOwnPropertyDescriptor("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !*desc.Writable || !*desc.Enumerable || !*desc.Configurable || desc.Get != nil || desc.Set != nil {
+		t.Errorf("Unexpected descriptor for a: %+v", desc)
+	}
+	if json := toJsonOrFatal(desc.Value.(*Value), t); json != "1" {
+		t.Errorf("Expected the value 1, got %s", json)
+	}
+
+	desc, err = obj.GetOwnPropertyDescriptor("b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if desc.Value != nil || desc.Writable != nil || !*desc.Enumerable || desc.Set != nil {
+		t.Errorf("Unexpected descriptor for b: %+v", desc)
+	}
+	if res, err := desc.Get.(*Value).Call(obj); err != nil || toJsonOrFatal(res, t) != "2" {
+		t.Errorf("Expected the getter to return 2, got %v", err)
+	}
+
+	if desc, err := obj.GetOwnPropertyDescriptor("toString"); err != nil || desc != nil {
+		t.Errorf("Expected no descriptor for an inherited property, got %+v, %v", desc, err)
+	}
+}
+
+func TestIntegrity(t *testing.T) {
+	ctx := NewContext()
+	check := func(what, js string, expected string) {
+		res, err := ctx.Eval(`"use strict"; var r = []; `+js+`; r.join()`, NO_FILE)
+		if err != nil {
+			t.Fatal(err)
+		} else if res != expected {
+			t.Errorf("%s: expected %s, got %v", what, expected, res)
+		}
+	}
+	const tries = `
+		try { o.added = 1; r.push("added"); } catch (e) {}
+		try { o.a = 2; r.push("changed"); } catch (e) {}
+		try { delete o.b; r.push("deleted"); } catch (e) {}`
+
+	for _, test := range []struct {
+		name     string
+		lock     func(v *Value) error
+		expected string
+	}{
+		{"PreventExtensions", (*Value).PreventExtensions, "changed,deleted"},
+		{"Seal", (*Value).Seal, "changed"},
+		{"Freeze", (*Value).Freeze, ""},
+	} {
+		obj := evalOrFatal(t, ctx, `var o = {a: 1, b: 1}; o`)
+		if err := test.lock(obj); err != nil {
+			t.Fatal(err)
+		}
+		check(test.name, tries, test.expected)
+	}
+
+	// Scripts replacing Object do not get in the way.
+	obj := evalOrFatal(t, ctx, `Object = null; var o = {a: 1, b: 1}; o`)
+	if err := obj.PreventExtensions(); err != nil {
+		t.Fatal(err)
+	}
+	check("PreventExtensions after replacing Object", tries, "changed,deleted")
+
+	if err := evalOrFatal(t, ctx, `1`).Freeze(); err == nil {
+		t.Error("Expected an error for a primitive")
+	}
+}
@@ -0,0 +1,203 @@
+package v8
+
+// #include "v8wrap.h"
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// ContextOptions configures a context created with NewContextWithOptions.
+type ContextOptions struct {
+	// GlobalResolver, unless nil, is called with the identifiers that are
+	// defined nowhere else, i.e. not on the global object nor its
+	// prototypes, when a script reads them.  It returns the value to use, or
+	// false to let the lookup fail as usual.  Like for DynamicObject.Get, the
+	// value is a *Value, which stays the resolver's, or a Go value converted
+	// with ToValue and released once the script has it.  See
+	// SetGlobalResolver.
+	GlobalResolver func(name string) (interface{}, bool)
+
+	// GlobalName is the class name of the global object, and thus the name of
+	// its constructor.
+	GlobalName string
+	// GlobalPrototype, unless nil, is converted with ToValue and inserted in
+	// the prototype chain of the global object, so that its properties can be
+	// read as globals.  It must convert to an object.
+	GlobalPrototype interface{}
+	// Globals are set with SetGlobal once the context is created.
+	Globals map[string]interface{}
+	// Functions are registered as global functions with Bind.
+	Functions map[string]interface{}
+	// RemoveBuiltins lists builtin globals to delete, e.g. "Reflect".  They
+	// are deleted before Globals and Functions are set; naming a global that
+	// does not exist is an error.
+	RemoveBuiltins []string
+	// DisallowCodeGeneration makes eval and new Function throw an EvalError,
+	// so that scripts cannot run code built from strings.
+	DisallowCodeGeneration bool
+}
+
+// NewContextWithOptions creates a V8 context in the given isolate, or in the
+// default isolate if isolate is nil, and returns a handle to it.  If an
+// option cannot be applied, the context is destroyed and the error returned.
+func NewContextWithOptions(isolate *V8Isolate, opts ContextOptions) (*V8Context, error) {
+	if isolate == nil {
+		isolate = defaultIsolate
+	}
+	name := newCString(opts.GlobalName)
+	defer freeCString(name)
+	copts := C.ContextOpts{
+		global_resolver:          C.bool(opts.GlobalResolver != nil),
+		global_name:              name,
+		disallow_code_generation: C.bool(opts.DisallowCodeGeneration),
+	}
+	v := newContext(isolate, &copts)
+	v.globalResolver = opts.GlobalResolver
+	v.hasGlobalResolver = opts.GlobalResolver != nil
+
+	if err := v.applyOptions(opts); err != nil {
+		v.Destroy()
+		return nil, err
+	}
+	return v, nil
+}
+
+// applyOptions applies the options that NewContextWithOptions does not pass
+// to V8.
+func (v *V8Context) applyOptions(opts ContextOptions) error {
+	if err := v.removeBuiltins(opts.RemoveBuiltins); err != nil {
+		return err
+	}
+	if opts.GlobalPrototype != nil {
+		if err := v.setGlobalPrototype(opts.GlobalPrototype); err != nil {
+			return err
+		}
+	}
+	for _, name := range sortedKeys(opts.Globals) {
+		if err := v.SetGlobal(name, opts.Globals[name]); err != nil {
+			return fmt.Errorf("Cannot set global %s: %v", name, err)
+		}
+	}
+	for _, name := range sortedKeys(opts.Functions) {
+		if err := v.Bind(name, opts.Functions[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (v *V8Context) removeBuiltins(names []string) error {
+	var err error
+	v.exec(func() {
+		global := v.Global()
+		defer v.releaseValues(global)
+		for _, name := range names {
+			// Deleting a missing property succeeds, which would hide typos.
+			var desc *PropertyDescriptor
+			if desc, err = global.GetOwnPropertyDescriptor(name); err == nil && desc == nil {
+				err = errors.New("no such global")
+			} else if desc != nil {
+				for _, field := range []interface{}{desc.Value, desc.Get, desc.Set} {
+					if val, ok := field.(*Value); ok {
+						v.releaseValues(val)
+					}
+				}
+			}
+			if err == nil {
+				err = global.Delete(name)
+			}
+			if err != nil {
+				err = fmt.Errorf("Cannot remove builtin %s: %v", name, err)
+				return
+			}
+		}
+	})
+	return err
+}
+
+func (v *V8Context) setGlobalPrototype(proto interface{}) error {
+	var err error
+	v.exec(func() {
+		if v.v8context == nil {
+			err = ErrContextDestroyed
+			return
+		}
+		var val *Value
+		if val, err = v.toJS(proto); err != nil {
+			err = fmt.Errorf("Cannot convert the global prototype: %v", err)
+			return
+		}
+		defer v.releaseValues(val)
+		if !C.v8_set_global_prototype(v.v8context, val.ptr) {
+			if C.v8_context_has_terminated(v.v8context) {
+				err = ErrTerminated
+				return
+			}
+			err = errors.New(takeCString(C.v8_error(v.v8context)))
+		}
+	})
+	return err
+}
+
+// sortedKeys returns the keys of m in order, so that options are applied
+// deterministically.
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// SetGlobalResolver replaces the GlobalResolver of a context created with
+// one.  f may be nil to stop resolving identifiers.
+func (v *V8Context) SetGlobalResolver(f func(name string) (interface{}, bool)) error {
+	var err error
+	v.exec(func() {
+		switch {
+		case v.v8context == nil:
+			err = ErrContextDestroyed
+		case !v.hasGlobalResolver:
+			err = errors.New("The context was not created with a GlobalResolver")
+		default:
+			v.globalResolver = f
+		}
+	})
+	return err
+}
+
+//export _go_v8_resolve_global
+func _go_v8_resolve_global(ctxID C.uint, name C.String, errmsg *C.String) C.PersistentValuePtr {
+	contextsMutex.RLock()
+	ctx := contexts[uint(ctxID)]
+	contextsMutex.RUnlock()
+	if ctx == nil {
+		*errmsg = newCString(ErrContextDestroyed.Error())
+		return nil
+	}
+	if ctx.globalResolver == nil {
+		return nil
+	}
+	prop, ok := ctx.globalResolver(C.GoStringN(name.ptr, name.len))
+	if !ok {
+		return nil
+	}
+	res, isValue := prop.(*Value)
+	if !isValue {
+		var err error
+		if res, err = ctx.ToValue(prop); err != nil {
+			*errmsg = newCString(err.Error())
+			return nil
+		}
+		ctx.releaseLater(res)
+	}
+	if err := res.checkIn(ctx); err != nil {
+		*errmsg = newCString(err.Error())
+		return nil
+	}
+	return res.ptr
+}
@@ -0,0 +1,106 @@
+package v8
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGlobalResolver(t *testing.T) {
+	cells := map[string]float64{"A1": 1, "B2": 2, "total": 100}
+	var resolved []string
+	resolver := func(name string) (interface{}, bool) {
+		resolved = append(resolved, name)
+		cell, ok := cells[name]
+		return cell, ok
+	}
+	ctx, err := NewContextWithOptions(nil, ContextOptions{GlobalResolver: resolver})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res, err := ctx.Eval(`var total = 3; A1 + B2 * total + Math.PI * 0`, NO_FILE); err != nil || res != 7.0 {
+		t.Errorf("Expected 7, got %v, %v", res, err)
+	}
+	if strings.Join(resolved, ",") != "A1,B2" {
+		t.Errorf("Expected only undefined identifiers to be resolved, got %v", resolved)
+	}
+	before := liveValues(ctx)
+	if res, err := ctx.Eval(`var sum = 0; for (var i = 0; i < 100; i++) sum += A1; sum`, NO_FILE); err != nil || res != 100.0 {
+		t.Errorf("Expected 100, got %v, %v", res, err)
+	}
+	// The last value is only released by the next operation.
+	if live := liveValues(ctx); live > before+1 {
+		t.Errorf("Expected resolved values to be released, got %d live values instead of %d", live, before)
+	}
+	if _, err := ctx.Eval(`C3`, NO_FILE); err == nil || !strings.Contains(err.Error(), "ReferenceError") {
+		t.Errorf("Expected a ReferenceError, got %v", err)
+	}
+	if res, err := ctx.Eval(`typeof Z9`, NO_FILE); err != nil || res != "undefined" {
+		t.Errorf("Expected undefined, got %v, %v", res, err)
+	}
+
+	if err := ctx.SetGlobalResolver(nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ctx.Eval(`A1`, NO_FILE); err == nil {
+		t.Error("Expected a ReferenceError once the resolver is removed")
+	}
+
+	if err := NewContext().SetGlobalResolver(resolver); err == nil {
+		t.Error("Expected an error for a context created without a resolver")
+	}
+}
+
+func TestContextOptions(t *testing.T) {
+	var logged []string
+	ctx, err := NewContextWithOptions(nil, ContextOptions{
+		GlobalName:      "Sandbox",
+		GlobalPrototype: map[string]interface{}{"version": "1.0"},
+		Globals:         map[string]interface{}{"limits": []int{1, 2}},
+		Functions: map[string]interface{}{
+			"log": func(s string) { logged = append(logged, s) },
+		},
+		RemoveBuiltins:         []string{"Reflect", "escape"},
+		DisallowCodeGeneration: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := ctx.Eval(`
+		log("hello");
+		[this.constructor.name, version, limits[1], typeof Reflect, typeof escape, typeof JSON]`, NO_FILE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []interface{}{"Sandbox", "1.0", 2.0, "undefined", "undefined", "object"}
+	if !reflect.DeepEqual(res, expected) {
+		t.Errorf("Expected %v, got %v", expected, res)
+	}
+	if strings.Join(logged, ",") != "hello" {
+		t.Errorf("Expected log to be called, got %v", logged)
+	}
+
+	for _, js := range []string{`eval("1")`, `new Function("return 1")()`, `(0, eval)("1")`} {
+		if _, err := ctx.Eval(js, NO_FILE); err == nil || !strings.Contains(err.Error(), "EvalError") {
+			t.Errorf("%s: expected an EvalError, got %v", js, err)
+		}
+	}
+	if res, err := NewContext().Eval(`eval("1 + 1")`, NO_FILE); err != nil || res != 2.0 {
+		t.Errorf("Expected eval to work by default, got %v, %v", res, err)
+	}
+
+	if _, err := NewContextWithOptions(nil, ContextOptions{RemoveBuiltins: []string{"undefined"}}); err == nil {
+		t.Error("Expected an error removing a non-configurable global")
+	}
+	if _, err := NewContextWithOptions(nil, ContextOptions{RemoveBuiltins: []string{"Reflekt"}}); err == nil || !strings.Contains(err.Error(), "Reflekt") {
+		t.Errorf("Expected an error removing a missing global, got %v", err)
+	}
+	if _, err := NewContextWithOptions(nil, ContextOptions{GlobalPrototype: 1}); err == nil {
+		t.Error("Expected an error for a primitive prototype")
+	}
+	if _, err := NewContextWithOptions(nil, ContextOptions{Functions: map[string]interface{}{"f": 1}}); err == nil {
+		t.Error("Expected an error for a function that is not one")
+	}
+}
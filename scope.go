@@ -0,0 +1,77 @@
+package v8
+
+// ValueScope collects every Value created in its context while it is the
+// innermost open scope, and releases them all at once when it is closed:
+//
+//	scope := ctx.NewValueScope()
+//	defer scope.Close()
+//
+// Scopes belong to the context, not to a goroutine.  When several goroutines
+// share a context, open and close scopes inside V8Context.Do so that values
+// created by other goroutines don't end up in the wrong scope.
+type ValueScope struct {
+	ctx         *V8Context
+	persistents []*persistent
+}
+
+// NewValueScope opens a new scope nested inside the currently open ones.
+func (v *V8Context) NewValueScope() *ValueScope {
+	s := &ValueScope{ctx: v}
+	v.valuesMu.Lock()
+	v.scopes = append(v.scopes, s)
+	v.valuesMu.Unlock()
+	return s
+}
+
+func (s *ValueScope) add(p *persistent) {
+	s.persistents = append(s.persistents, p)
+}
+
+// Escape removes val from the scope so that it survives Close.  If the scope
+// is nested, val moves to the enclosing scope, otherwise it stays alive until
+// it is released explicitly.  Escape returns val for convenience.
+func (s *ValueScope) Escape(val *Value) *Value {
+	v := s.ctx
+	v.valuesMu.Lock()
+	defer v.valuesMu.Unlock()
+	for i, p := range s.persistents {
+		if p == val.persistent {
+			s.persistents = append(s.persistents[:i], s.persistents[i+1:]...)
+			break
+		}
+	}
+	for i, scope := range v.scopes {
+		if scope == s && i > 0 {
+			v.scopes[i-1].add(val.persistent)
+			break
+		}
+	}
+	return val
+}
+
+// Close releases every value collected by the scope that hasn't been released
+// or escaped yet, and removes the scope from its context.  Closing a scope
+// twice has no effect.
+func (s *ValueScope) Close() error {
+	v := s.ctx
+	v.exec(func() {
+		v.valuesMu.Lock()
+		defer v.valuesMu.Unlock()
+		for i, scope := range v.scopes {
+			if scope == s {
+				v.scopes = append(v.scopes[:i], v.scopes[i+1:]...)
+				break
+			}
+		}
+		if v.v8context == nil {
+			return
+		}
+		for _, p := range s.persistents {
+			if p.ptr != nil {
+				v.releaseLocked(p)
+			}
+		}
+		s.persistents = nil
+	})
+	return nil
+}
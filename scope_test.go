@@ -0,0 +1,104 @@
+package v8
+
+import (
+	"runtime"
+	"testing"
+	"time"
+)
+
+func liveValues(ctx *V8Context) int {
+	ctx.valuesMu.Lock()
+	defer ctx.valuesMu.Unlock()
+	return len(ctx.values)
+}
+
+func TestValueScope(t *testing.T) {
+	ctx := NewContext()
+	before := liveValues(ctx)
+
+	scope := ctx.NewValueScope()
+	ob, err := ctx.CreateJS(`{a:1, b:2}`, NO_FILE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ob.Burst(); err != nil {
+		t.Fatal(err)
+	}
+	kept := scope.Escape(ob)
+	if live := liveValues(ctx); live != before+3 {
+		t.Fatalf("Expected %d live values, got %d", before+3, live)
+	}
+	scope.Close()
+
+	if live := liveValues(ctx); live != before+1 {
+		t.Errorf("Expected only the escaped value to survive, got %d live values", live-before)
+	}
+	if str := toJsonOrFatal(kept, t); str != `{"a":1,"b":2}` {
+		t.Errorf("Escaped value is broken: %s", str)
+	}
+}
+
+func TestNestedValueScopes(t *testing.T) {
+	ctx := NewContext()
+	before := liveValues(ctx)
+
+	outer := ctx.NewValueScope()
+	inner := ctx.NewValueScope()
+	val, err := ctx.CreateJS(`1`, NO_FILE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inner.Escape(val)
+	inner.Close()
+	if val.ptr == nil {
+		t.Fatal("Escaped value was released by the inner scope")
+	}
+	outer.Close()
+	if val.ptr != nil {
+		t.Error("Escaped value was not released by the outer scope")
+	}
+	if live := liveValues(ctx); live != before {
+		t.Errorf("Expected %d live values, got %d", before, live)
+	}
+}
+
+func TestReleaseValueTwice(t *testing.T) {
+	ctx := NewContext()
+	val, err := ctx.CreateJS(`1`, NO_FILE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ctx.ReleaseValue(val); err != nil {
+		t.Fatal(err)
+	}
+	if err := ctx.ReleaseValue(val); err == nil {
+		t.Error("Expected an error releasing a value twice")
+	}
+}
+
+func TestAutoRelease(t *testing.T) {
+	ctx := NewContext()
+	ctx.SetAutoRelease(true)
+	before := liveValues(ctx)
+
+	f, err := ctx.CreateJS(`function(x) { return {x:x}; }`, NO_FILE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 1000; i++ {
+		if _, err := ctx.Apply(f, nil, f); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i := 0; i < 50 && liveValues(ctx) > before+1; i++ {
+		runtime.GC()
+		time.Sleep(time.Millisecond)
+		// Collected handles are released by the next operation.
+		ctx.Eval(`0`, NO_FILE)
+	}
+	if live := liveValues(ctx); live > before+1 {
+		t.Errorf("Expected unreachable values to be released, %d still live", live-before)
+	}
+	runtime.KeepAlive(f)
+}
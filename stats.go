@@ -0,0 +1,95 @@
+package v8
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"runtime"
+)
+
+// ValueStats describes the Value handles allocated by a context.
+type ValueStats struct {
+	// Live is the number of Values currently holding a V8 handle.
+	Live int
+	// Peak is the highest Live count reached so far.
+	Peak int
+	// Allocated and Released count the Values created and released since
+	// the context was created.
+	Allocated, Released uint64
+}
+
+// Stats returns the value handle statistics of the context.
+func (v *V8Context) Stats() ValueStats {
+	v.valuesMu.Lock()
+	defer v.valuesMu.Unlock()
+	stats := v.stats
+	stats.Live = len(v.values)
+	return stats
+}
+
+// SetLeakTracking enables or disables leak tracking.  While w is non-nil, the
+// context records the Go call stack that creates each Value, and Destroy
+// writes the creation stacks of the Values that are still live to w.
+func (v *V8Context) SetLeakTracking(w io.Writer) {
+	v.valuesMu.Lock()
+	v.leakReport = w
+	v.valuesMu.Unlock()
+}
+
+// OutstandingValues returns the creation stacks of the live Values that were
+// created while leak tracking was enabled.
+func (v *V8Context) OutstandingValues() []string {
+	v.valuesMu.Lock()
+	defer v.valuesMu.Unlock()
+	var res []string
+	for p := range v.values {
+		if p.origin != nil {
+			res = append(res, formatStack(p.origin))
+		}
+	}
+	return res
+}
+
+// countNewLocked updates the statistics for a newly allocated value, and
+// records its origin when leak tracking is enabled.
+func (v *V8Context) countNewLocked(p *persistent) {
+	v.stats.Allocated++
+	if live := len(v.values); live > v.stats.Peak {
+		v.stats.Peak = live
+	}
+	if v.leakReport != nil {
+		pcs := make([]uintptr, 32)
+		// Skip runtime.Callers, countNewLocked and newValue.
+		p.origin = pcs[:runtime.Callers(3, pcs)]
+	}
+}
+
+func (v *V8Context) reportLeaks() {
+	v.valuesMu.Lock()
+	w := v.leakReport
+	v.valuesMu.Unlock()
+	if w == nil {
+		return
+	}
+	leaks := v.OutstandingValues()
+	if len(leaks) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "v8: context %d destroyed with %d outstanding values:\n", v.id, len(leaks))
+	for _, stack := range leaks {
+		fmt.Fprintf(w, "%s\n", stack)
+	}
+}
+
+func formatStack(pcs []uintptr) string {
+	var buf bytes.Buffer
+	frames := runtime.CallersFrames(pcs)
+	for {
+		frame, more := frames.Next()
+		fmt.Fprintf(&buf, "%s\n\t%s:%d\n", frame.Function, frame.File, frame.Line)
+		if !more {
+			break
+		}
+	}
+	return buf.String()
+}
@@ -0,0 +1,59 @@
+package v8
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	ctx := NewContext()
+	start := ctx.Stats()
+
+	a, _ := ctx.CreateJS(`1`, NO_FILE)
+	b, _ := ctx.CreateJS(`2`, NO_FILE)
+	ctx.ReleaseValue(a)
+	ctx.ReleaseValue(b)
+	ctx.CreateJS(`3`, NO_FILE)
+
+	stats := ctx.Stats()
+	if stats.Live != start.Live+1 {
+		t.Errorf("Expected %d live values, got %d", start.Live+1, stats.Live)
+	}
+	if stats.Peak != start.Live+2 {
+		t.Errorf("Expected a peak of %d, got %d", start.Live+2, stats.Peak)
+	}
+	if n := stats.Allocated - start.Allocated; n != 3 {
+		t.Errorf("Expected 3 allocations, got %d", n)
+	}
+	if n := stats.Released - start.Released; n != 2 {
+		t.Errorf("Expected 2 releases, got %d", n)
+	}
+}
+
+func leakyHelper(ctx *V8Context) {
+	ctx.CreateJS(`{leaked:true}`, NO_FILE)
+}
+
+func TestLeakTracking(t *testing.T) {
+	ctx := NewContext()
+	var report bytes.Buffer
+	ctx.SetLeakTracking(&report)
+
+	before := ctx.Stats().Live
+	leakyHelper(ctx)
+	if leaked := ctx.Stats().Live - before; leaked != 1 {
+		t.Fatalf("Expected leakyHelper to leak 1 value, got %d", leaked)
+	}
+
+	outstanding := ctx.OutstandingValues()
+	if len(outstanding) != 1 || !strings.Contains(outstanding[0], "leakyHelper") {
+		t.Errorf("Expected the leak to be attributed to leakyHelper, got %v", outstanding)
+	}
+
+	ctx.Destroy()
+	if !strings.Contains(report.String(), "1 outstanding values") ||
+		!strings.Contains(report.String(), "leakyHelper") {
+		t.Errorf("Unexpected leak report:\n%s", report.String())
+	}
+}
@@ -0,0 +1,156 @@
+package v8
+
+// #include "v8wrap.h"
+import "C"
+
+import "errors"
+
+// Tx is a handle to a V8 context whose isolate stays locked, and whose context
+// stays entered, for the duration of a V8Context.Do callback.  Operations on
+// the context and on its Values made inside the callback reuse that lock
+// instead of acquiring their own, and no other thread can use the isolate in
+// between them.
+//
+// A Tx must not be used after the callback it was passed to returns: its
+// methods then fail with ErrTxDone.
+type Tx struct {
+	ctx  *V8Context
+	done bool
+}
+
+// Error returned when using a Tx after its V8Context.Do callback returned.
+var ErrTxDone = errors.New("Tx used outside of its Do callback")
+
+// Do locks the context's isolate, enters the context and calls f.  The lock
+// is held until f returns, so the operations f performs are atomic with
+// respect to other goroutines using the same isolate.  The error returned by
+// f is returned by Do.
+//
+// Calling Unlocked from a callback invoked inside f releases the lock early.
+func (v *V8Context) Do(f func(tx *Tx) error) error {
+	var err error
+	v.exec(func() {
+		if v.v8context == nil {
+			err = ErrContextDestroyed
+			return
+		}
+		C.v8_enter(v.v8context)
+		defer C.v8_exit(v.v8context)
+
+		tx := &Tx{ctx: v}
+		defer func() { tx.done = true }()
+		err = f(tx)
+	})
+	return err
+}
+
+func (tx *Tx) context() (*V8Context, error) {
+	if tx.done {
+		return nil, ErrTxDone
+	}
+	return tx.ctx, nil
+}
+
+// Context returns the context the transaction operates on.
+func (tx *Tx) Context() *V8Context {
+	return tx.ctx
+}
+
+// Eval is V8Context.Eval within the transaction.
+func (tx *Tx) Eval(javascript string, filename string) (interface{}, error) {
+	ctx, err := tx.context()
+	if err != nil {
+		return nil, err
+	}
+	return ctx.Eval(javascript, filename)
+}
+
+// EvalRaw is V8Context.EvalRaw within the transaction.
+func (tx *Tx) EvalRaw(js string, filename string) (*Value, error) {
+	ctx, err := tx.context()
+	if err != nil {
+		return nil, err
+	}
+	return ctx.EvalRaw(js, filename)
+}
+
+// CreateJS is V8Context.CreateJS within the transaction.
+func (tx *Tx) CreateJS(js, filename string) (*Value, error) {
+	ctx, err := tx.context()
+	if err != nil {
+		return nil, err
+	}
+	return ctx.CreateJS(js, filename)
+}
+
+// Run is V8Context.Run within the transaction.
+func (tx *Tx) Run(funcname string, args ...interface{}) (interface{}, error) {
+	ctx, err := tx.context()
+	if err != nil {
+		return nil, err
+	}
+	return ctx.Run(funcname, args...)
+}
+
+// RunRaw is V8Context.RunRaw within the transaction.
+func (tx *Tx) RunRaw(funcname string, args ...interface{}) (*Value, error) {
+	ctx, err := tx.context()
+	if err != nil {
+		return nil, err
+	}
+	return ctx.RunRaw(funcname, args...)
+}
+
+// Global is V8Context.Global within the transaction.  Once the transaction is
+// done, it returns a released Value.
+func (tx *Tx) Global() *Value {
+	if tx.done {
+		return &Value{&persistent{}, tx.ctx}
+	}
+	return tx.ctx.Global()
+}
+
+// SetGlobal is V8Context.SetGlobal within the transaction.
+func (tx *Tx) SetGlobal(name string, val interface{}) error {
+	ctx, err := tx.context()
+	if err != nil {
+		return err
+	}
+	return ctx.SetGlobal(name, val)
+}
+
+// Apply is V8Context.Apply within the transaction.
+func (tx *Tx) Apply(f, this *Value, args ...*Value) (*Value, error) {
+	ctx, err := tx.context()
+	if err != nil {
+		return nil, err
+	}
+	return ctx.Apply(f, this, args...)
+}
+
+// ParseJSON is V8Context.ParseJSON within the transaction.
+func (tx *Tx) ParseJSON(data []byte) (*Value, error) {
+	ctx, err := tx.context()
+	if err != nil {
+		return nil, err
+	}
+	return ctx.ParseJSON(data)
+}
+
+// FromJSON is V8Context.FromJSON within the transaction.
+func (tx *Tx) FromJSON(s string) (*Value, error) {
+	ctx, err := tx.context()
+	if err != nil {
+		return nil, err
+	}
+	return ctx.FromJSON(s)
+}
+
+// ToValue is V8Context.ToValue within the transaction.
+func (tx *Tx) ToValue(val interface{}) (*Value, error) {
+	ctx, err := tx.context()
+	if err != nil {
+		return nil, err
+	}
+	return ctx.ToValue(val)
+}
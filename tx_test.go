@@ -0,0 +1,172 @@
+package v8
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDo(t *testing.T) {
+	ctx := NewContext()
+
+	var sum float64
+	err := ctx.Do(func(tx *Tx) error {
+		ob, err := tx.CreateJS(`{a:1, b:2, c:3}`, NO_FILE)
+		if err != nil {
+			return err
+		}
+		fields, err := ob.Burst()
+		if err != nil {
+			return err
+		}
+		for _, field := range fields {
+			res, err := tx.Apply(mustCreateJS(t, tx, `function(x) { return x; }`), nil, field)
+			if err != nil {
+				return err
+			}
+			var n float64
+			if err := decodeJSON(res, &n); err != nil {
+				return err
+			}
+			sum += n
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum != 6 {
+		t.Errorf("Expected 6, got %v", sum)
+	}
+}
+
+func TestDoReturnsError(t *testing.T) {
+	ctx := NewContext()
+	boom := errors.New("boom")
+	if err := ctx.Do(func(tx *Tx) error { return boom }); err != boom {
+		t.Errorf("Expected %v, got %v", boom, err)
+	}
+
+	// The context is still usable afterwards.
+	if res, err := ctx.Eval(`1+1`, NO_FILE); err != nil || res.(float64) != 2 {
+		t.Errorf("Expected 2, got %v (err: %v)", res, err)
+	}
+}
+
+func TestDoIsAtomic(t *testing.T) {
+	ctx := NewContext()
+	if _, err := ctx.Eval(`var x = 0;`, NO_FILE); err != nil {
+		t.Fatal(err)
+	}
+
+	entered := make(chan struct{})
+	written := make(chan error)
+	err := ctx.Do(func(tx *Tx) error {
+		if _, err := tx.Eval(`x = 1`, NO_FILE); err != nil {
+			return err
+		}
+		go func() {
+			<-entered
+			_, err := ctx.Eval(`x = 2`, NO_FILE)
+			written <- err
+		}()
+		close(entered)
+		time.Sleep(20 * time.Millisecond)
+
+		res, err := tx.Eval(`x`, NO_FILE)
+		if err != nil {
+			return err
+		}
+		if res.(float64) != 1 {
+			t.Errorf("Another goroutine modified x during Do: %v", res)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := <-written; err != nil {
+		t.Fatal(err)
+	}
+	if res, _ := ctx.Eval(`x`, NO_FILE); res.(float64) != 2 {
+		t.Errorf("Expected the write after Do to land, got %v", res)
+	}
+}
+
+func TestTxUsedAfterDo(t *testing.T) {
+	ctx := NewContext()
+	var saved *Tx
+	ctx.Do(func(tx *Tx) error {
+		saved = tx
+		return nil
+	})
+	if _, err := saved.EvalRaw(`1`, NO_FILE); err != ErrTxDone {
+		t.Errorf("Expected ErrTxDone, got %v", err)
+	}
+	if err := saved.SetGlobal("x", 1); err != ErrTxDone {
+		t.Errorf("Expected ErrTxDone, got %v", err)
+	}
+	if _, err := saved.Global().Get("x"); err == nil {
+		t.Error("Expected an error using the global object after Do")
+	}
+}
+
+func mustCreateJS(t testing.TB, tx *Tx, js string) *Value {
+	val, err := tx.CreateJS(js, NO_FILE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return val
+}
+
+func decodeJSON(v *Value, dst interface{}) error {
+	str, err := v.ToJSON()
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal([]byte(str), dst)
+}
+
+func benchmarkFieldWalk(b *testing.B, walk func(ctx *V8Context, ob *Value) error) {
+	ctx := NewContext()
+	ob, err := ctx.CreateJS(`{a:1, b:2, c:3, d:4, e:5, f:6, g:7, h:8}`, NO_FILE)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := walk(ctx, ob); err != nil {
+			b.Fatal(err)
+		}
+		b.StopTimer()
+		ctx.ClearValues()
+		ob, _ = ctx.CreateJS(`{a:1, b:2, c:3, d:4, e:5, f:6, g:7, h:8}`, NO_FILE)
+		b.StartTimer()
+	}
+}
+
+func walkFields(ob *Value) error {
+	fields, err := ob.Burst()
+	if err != nil {
+		return err
+	}
+	for _, field := range fields {
+		if _, err := field.ToJSON(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func BenchmarkFieldWalk(b *testing.B) {
+	benchmarkFieldWalk(b, func(ctx *V8Context, ob *Value) error {
+		return walkFields(ob)
+	})
+}
+
+func BenchmarkFieldWalkInDo(b *testing.B) {
+	benchmarkFieldWalk(b, func(ctx *V8Context, ob *Value) error {
+		return ctx.Do(func(tx *Tx) error { return walkFields(ob) })
+	})
+}
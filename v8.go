@@ -8,15 +8,15 @@ package v8
 import "C"
 
 import (
-	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"path"
+	"io"
 	"reflect"
 	"runtime"
+	"strconv"
+	"strings"
 	"sync"
-	"text/template"
 	"unsafe"
 )
 
@@ -31,6 +31,17 @@ var highestContextId uint
 // TODO(avaskys): Move the Terminate() function from the context to the isolate.
 var ErrTerminated = errors.New("Operation terminated prematurely")
 
+// Error returned when using a context after Destroy(), or a Value whose context
+// has been destroyed.
+var ErrContextDestroyed = errors.New("Context has been destroyed")
+
+// Error returned when using a Value after it has been released, either
+// explicitly or via ClearValues(), a ValueScope or automatic release.
+var ErrValueReleased = errors.New("Value has been released")
+
+// Error returned when calling a method on a nil *Value.
+var ErrNilValue = errors.New("Value is nil")
+
 // A constant indicating that a particular script evaluation is not associated
 // with any file.
 const NO_FILE = ""
@@ -38,205 +49,220 @@ const NO_FILE = ""
 // Value represents a handle to a V8::Value.  It is associated with a particular
 // context and attempts to use it with a different context will fail.
 type Value struct {
-	ptr C.PersistentValuePtr
+	*persistent
 	ctx *V8Context
 }
 
-// ToJSON converts the value to a JSON string.
-func (v *Value) ToJSON() (string, error) {
-	if v.ctx == nil || v.ptr == nil {
-		panic("Value or context were reset.")
+// persistent is the V8 persistent handle behind a Value.  Contexts track
+// persistents rather than Values, so that unreachable Values may be garbage
+// collected.  ptr is nil once the handle has been released.
+type persistent struct {
+	ptr C.PersistentValuePtr
+
+	// The Go call stack that created the value, if leak tracking is enabled.
+	origin []uintptr
+}
+
+// check returns an error if the value may no longer be used.  It must be
+// called on a thread that may use the isolate (i.e. inside exec).
+func (v *Value) check() error {
+	if v == nil {
+		return ErrNilValue
+	}
+	if v.ctx == nil || v.ctx.v8context == nil {
+		return ErrContextDestroyed
 	}
-	str := C.PersistentToJSON(v.ctx.v8context, v.ptr)
-	if str == nil {
-		if C.v8_context_has_terminated(v.ctx.v8context) {
-			return "", ErrTerminated
-		}
-		err := C.v8_error(v.ctx.v8context)
-		out := C.GoString(err)
-		C.free(unsafe.Pointer(err))
-		return "", errors.New(out)
+	if v.ptr == nil {
+		return ErrValueReleased
 	}
-	defer C.free(unsafe.Pointer(str))
-	return C.GoString(str), nil
+	return nil
 }
 
-// ToString converts a value holding a JS String to a string.  If the value
-// is not actually a string, this will return an error.
-func (v *Value) ToString() (string, error) {
-	if v.ctx == nil || v.ptr == nil {
-		panic("Value or context were reset.")
+// checkIn returns an error if the value may not be used in ctx.
+func (v *Value) checkIn(ctx *V8Context) error {
+	if err := v.check(); err != nil {
+		return err
 	}
-	jsonStr, err := v.ToJSON()
-	if err != nil {
-		return "", err
+	if v.ctx != ctx {
+		return errors.New("Value belongs to another context.")
 	}
+	return nil
+}
+
+// ToJSON converts the value to a JSON string.
+func (v *Value) ToJSON() (string, error) {
+	return v.toJSON(nil)
+}
+
+// ToString converts a value holding a JS String to a string.  If the value
+// is not actually a string, this will return an error.  Lone surrogates,
+// which have no UTF-8 encoding, are replaced by U+FFFD; use ToUTF16 to keep
+// them.
+func (v *Value) ToString() (string, error) {
 	var str string
-	err = json.Unmarshal([]byte(jsonStr), &str)
+	err := v.withKind(C.VALUE_STRING, func() error {
+		str = takeCString(C.v8_value_string(v.ctx.v8context, v.ptr))
+		return nil
+	})
 	return str, err
 }
 
+// ToUTF16 returns the UTF-16 code units of a value holding a JS String,
+// exactly as JS sees them.
+func (v *Value) ToUTF16() ([]uint16, error) {
+	var res []uint16
+	err := v.withKind(C.VALUE_STRING, func() error {
+		var length C.int
+		data := C.v8_value_utf16(v.ctx.v8context, v.ptr, &length)
+		defer C.free(unsafe.Pointer(data))
+		res = make([]uint16, int(length))
+		if length > 0 {
+			copy(res, (*[1 << 30]uint16)(unsafe.Pointer(data))[:length:length])
+		}
+		return nil
+	})
+	return res, err
+}
+
 // Burst converts a value that represents a JS Object and returns a map of
 // key -> Value for each of the object's fields.  If the value is not an
 // Object, an error is returned.
 func (v *Value) Burst() (map[string]*Value, error) {
-	if v.ctx == nil || v.ptr == nil {
-		panic("Value or context were reset.")
+	if v == nil {
+		return nil, ErrNilValue
 	}
-	// Call cgo to burst the object, get a list of KeyValuePairs back.
-	var numKeys C.int
-	keyValuesPtr := C.v8_BurstPersistent(v.ctx.v8context, v.ptr, &numKeys)
-
-	if keyValuesPtr == nil {
-		if C.v8_context_has_terminated(v.ctx.v8context) {
-			return nil, ErrTerminated
-		}
-		err := C.v8_error(v.ctx.v8context)
-		defer C.free(unsafe.Pointer(err))
-		return nil, errors.New(C.GoString(err))
+	if v.ctx == nil {
+		return nil, ErrContextDestroyed
 	}
+	var result map[string]*Value
+	var err error
+	v.ctx.exec(func() {
+		if err = v.check(); err != nil {
+			return
+		}
+		// Call cgo to burst the object, get a list of KeyValuePairs back.
+		var numKeys C.int
+		keyValuesPtr := C.v8_BurstPersistent(v.ctx.v8context, v.ptr, &numKeys)
+		runtime.KeepAlive(v)
+
+		if keyValuesPtr == nil {
+			if C.v8_context_has_terminated(v.ctx.v8context) {
+				err = ErrTerminated
+				return
+			}
+			err = errors.New(takeCString(C.v8_error(v.ctx.v8context)))
+			return
+		}
 
-	// Convert the list to a slice:
-	var keyValues []C.struct_KeyValuePair
-	sliceHeader := (*reflect.SliceHeader)((unsafe.Pointer(&keyValues)))
-	sliceHeader.Cap = int(numKeys)
-	sliceHeader.Len = int(numKeys)
-	sliceHeader.Data = uintptr(unsafe.Pointer(keyValuesPtr))
-
-	// Create the object map:
-	result := make(map[string]*Value)
-	for _, keyVal := range keyValues {
-		key := C.GoString(keyVal.keyName)
-		val := v.ctx.newValue(keyVal.value)
-
-		result[key] = val
-
-		// Don't forget to clean up!
-		C.free(unsafe.Pointer(keyVal.keyName))
-	}
-	return result, nil
+		// Convert the list to a slice:
+		var keyValues []C.struct_KeyValuePair
+		sliceHeader := (*reflect.SliceHeader)((unsafe.Pointer(&keyValues)))
+		sliceHeader.Cap = int(numKeys)
+		sliceHeader.Len = int(numKeys)
+		sliceHeader.Data = uintptr(unsafe.Pointer(keyValuesPtr))
+
+		// Create the object map:
+		result = make(map[string]*Value)
+		for _, keyVal := range keyValues {
+			// Don't forget to clean up!
+			key := takeCString(keyVal.key)
+			val := v.ctx.newValue(keyVal.value)
+
+			result[key] = val
+		}
+	})
+	return result, err
 }
 
-// Returns the given field of the object.
-// TODO(mag): optimize.
+// Returns the given field of the object, which may be inherited.  It fails if
+// the field is undefined.
 func (v *Value) Get(field string) (*Value, error) {
 	if v == nil {
-		panic("nil value")
+		return nil, ErrNilValue
 	}
-	if v.ctx == nil || v.ptr == nil {
-		panic("Value or context were reset.")
+	if v.ctx == nil {
+		return nil, ErrContextDestroyed
 	}
+	var res *Value
+	var err error
+	v.ctx.exec(func() {
+		if err = v.check(); err != nil {
+			return
+		}
+		if res, err = v.ctx.get(v, field); err != nil {
+			return
+		}
+		if v.ctx.kind(res) == C.VALUE_UNDEFINED {
+			v.ctx.releaseValues(res)
+			res, err = nil, fmt.Errorf("field '%s' is undefined.", field)
+		}
+	})
+	return res, err
+}
 
-	fields, err := v.Burst()
-	if err != nil {
-		return nil, err
+// Delete deletes the given field of the object.  It fails if the field may
+// not be deleted, e.g. because it is not configurable.  Deleting a missing
+// field succeeds.
+func (v *Value) Delete(field string) error {
+	if v == nil {
+		return ErrNilValue
 	}
-	res, exists := fields[field]
-	if !exists || res == nil {
-		return nil, fmt.Errorf("field '%s' is undefined.", field)
+	if v.ctx == nil {
+		return ErrContextDestroyed
 	}
-	return res, nil
+	fieldPtr := newCString(field)
+	defer freeCString(fieldPtr)
+	var err error
+	v.ctx.exec(func() {
+		if err = v.check(); err != nil {
+			return
+		}
+		ok := C.v8_delete(v.ctx.v8context, v.ptr, fieldPtr)
+		runtime.KeepAlive(v)
+		if !ok {
+			if C.v8_context_has_terminated(v.ctx.v8context) {
+				err = ErrTerminated
+				return
+			}
+			err = errors.New(takeCString(C.v8_error(v.ctx.v8context)))
+		}
+	})
+	return err
 }
 
 func (v *Value) Set(field string, val *Value) error {
-	if v.ctx == nil || v.ptr == nil {
-		panic("Value or context were reset.")
+	if v == nil {
+		return ErrNilValue
 	}
-	fieldPtr := C.CString(field)
-	defer C.free(unsafe.Pointer(fieldPtr))
-	errmsg := C.v8_setPersistentField(v.ctx.v8context, v.ptr, fieldPtr, val.ptr)
-	if errmsg != nil {
-		return errors.New(C.GoString(errmsg))
+	if v.ctx == nil {
+		return ErrContextDestroyed
 	}
-	return nil
-}
-
-//export _go_v8_callback
-func _go_v8_callback(ctxID uint, name, args *C.char) *C.char {
-	runtime.UnlockOSThread()
-	defer runtime.LockOSThread()
-
-	contextsMutex.RLock()
-	c := contexts[ctxID]
-	contextsMutex.RUnlock()
-	f := c.funcs[C.GoString(name)]
-	if f != nil {
-		var argv []interface{}
-		json.Unmarshal([]byte(C.GoString(args)), &argv)
-		ret := f(argv...)
-		if ret != nil {
-			b, _ := json.Marshal(ret)
-			return C.CString(string(b))
+	fieldPtr := newCString(field)
+	defer freeCString(fieldPtr)
+	var err error
+	v.ctx.exec(func() {
+		if err = v.check(); err != nil {
+			return
 		}
-		return nil
-	}
-	return C.CString("undefined")
-}
-
-// TODO(mag): catch all panics in go functions, that are called from C code.
-//export _go_v8_callback_raw
-func _go_v8_callback_raw(
-	ctxID uint,
-	name *C.char,
-	callerFuncName, callerScriptName *C.char,
-	callerLineNumber, callerColumn C.int,
-	argc C.int,
-	argvptr C.PersistentValuePtr,
-) C.PersistentValuePtr {
-	runtime.UnlockOSThread()
-	defer runtime.LockOSThread()
-
-	funcname := C.GoString(name)
-
-	caller := Loc{
-		Funcname: C.GoString(callerFuncName),
-		Filename: C.GoString(callerScriptName),
-		Line:     int(callerLineNumber),
-		Column:   int(callerColumn),
-	}
-
-	contextsMutex.RLock()
-	ctx := contexts[ctxID]
-	contextsMutex.RUnlock()
-	function := ctx.rawFuncs[funcname]
-
-	var argv []C.PersistentValuePtr
-	sliceHeader := (*reflect.SliceHeader)((unsafe.Pointer(&argv)))
-	sliceHeader.Cap = int(argc)
-	sliceHeader.Len = int(argc)
-	sliceHeader.Data = uintptr(unsafe.Pointer(argvptr))
-
-	if function == nil {
-		panic(fmt.Errorf("No such registered raw function: %s", C.GoString(name)))
-	}
-
-	args := make([]*Value, argc)
-	for i := 0; i < int(argc); i++ {
-		args[i] = ctx.newValue(argv[i])
-	}
-
-	res, err := function(caller, args...)
-
-	if err != nil {
-		ctx.throw(err)
-		return nil
-	}
-
-	if res == nil {
-		return nil
-	}
-
-	if res.ctx.v8context != ctx.v8context {
-		panic(fmt.Errorf("Error processing return value of raw function callback %s: "+
-			"Return value was generated from another context.", C.GoString(name)))
-	}
-
-	return res.ptr
+		if err = val.checkIn(v.ctx); err != nil {
+			return
+		}
+		errmsg := C.v8_setPersistentField(v.ctx.v8context, v.ptr, fieldPtr, val.ptr)
+		runtime.KeepAlive(v)
+		runtime.KeepAlive(val)
+		if errmsg != nil {
+			err = errors.New(C.GoString(errmsg))
+		}
+	})
+	return err
 }
 
 // Function is the callback signature for functions that are registered with
-// a V8 context.  Arguments and return values are POD serialized via JSON and
-// unmarshaled into Go interface{}s via json.Unmarshal.
+// a V8 context.  Arguments are the Go values json.Unmarshal would produce for
+// their JSON: float64, string, bool, nil, []interface{} and
+// map[string]interface{}.  Dates become their ISO strings, and NaN,
+// undefined and functions become nil.  The return value is converted like
+// ToValue does.  Neither goes through JSON text.
 type Function func(...interface{}) interface{}
 
 // Loc defines a script location.
@@ -255,19 +281,54 @@ type RawFunction func(from Loc, args ...*Value) (*Value, error)
 
 type V8Isolate struct {
 	v8isolate C.IsolatePtr
+	exec      *executor
 }
 
 // V8Context is a handle to a v8 context.
 // NOTE: The current context implementation is not threadsafe and should only
-// be accessed from one goroutine at a time.
+// be accessed from one goroutine at a time, unless the context lives in an
+// isolate created with NewIsolateWithExecutor.
 type V8Context struct {
 	id        uint
 	v8context C.ContextPtr
 	v8isolate *V8Isolate
-	funcs     map[string]Function
-	rawFuncs  map[string]RawFunction
-	values    map[*Value]bool
+	values    map[*persistent]bool
 	valuesMu  *sync.Mutex
+
+	// Handles waiting to be released on a thread that may use the isolate:
+	// values collected by the Go GC and temporary results handed to JS.
+	// Guarded by valuesMu.
+	finalized   []*persistent
+	autoRelease bool
+	scopes      []*ValueScope
+	stats       ValueStats
+	leakReport  io.Writer
+
+	// Host functions by ID.  Guarded by hostFuncsMu, as are the fields up to
+	// releasedHostFuncs; V8 releases host functions from whichever thread
+	// collects them, so hostFuncsMu is never held while calling into V8.
+	hostFuncs    map[uint32]hostFunc
+	hostFuncsMu  *sync.Mutex
+	nextHostFunc uint32
+	// The number of JS functions calling each host function, which is
+	// dropped once they are all collected.
+	hostFuncRefs map[uint32]int
+	// The host functions of the globals defined by addGlobalFunction.
+	globalFuncs map[string]uint32
+	// The number of JS functions V8 has collected, for tests.
+	releasedHostFuncs int
+
+	// Go values referenced by JS objects, by handle.  Guarded by objectsMu,
+	// which is never held while calling into V8.
+	objects    map[uint64]interface{}
+	objectsMu  *sync.Mutex
+	nextObject uint64
+	wrapProtos map[reflect.Type]C.PersistentValuePtr
+
+	// Resolves undefined identifiers, for contexts created with a
+	// GlobalResolver.
+	globalResolver    func(name string) (interface{}, bool)
+	hasGlobalResolver bool
 }
 
 var platform C.PlatformPtr
@@ -278,23 +339,55 @@ func init() {
 	defaultIsolate = NewIsolate()
 }
 func NewIsolate() *V8Isolate {
-	res := &V8Isolate{C.v8_create_isolate()}
+	res := &V8Isolate{v8isolate: C.v8_create_isolate()}
 	runtime.SetFinalizer(res, func(i *V8Isolate) {
 		C.v8_release_isolate(i.v8isolate)
 	})
 	return res
 }
 
-func NewIsolateWithSnapshot(js string) (*V8Isolate, error) {
-	jsCstr := C.CString(js)
-	defer C.free(unsafe.Pointer(jsCstr))
+// NewIsolateWithExecutor creates an isolate that owns a dedicated, locked OS
+// thread.  Every operation on the isolate and on the contexts and values that
+// belong to it is sent to that thread and executed in submission order, so
+// those may be used concurrently from any goroutine.
+//
+// Go callbacks invoked from JS run on the executor thread, and may use the
+// isolate directly.  A callback must not wait for another goroutine that uses
+// the isolate, though: that goroutine's operations are queued behind the
+// callback, so both hang.  Such callbacks must do their waiting inside
+// Unlocked, which lets the executor serve other goroutines meanwhile.
+func NewIsolateWithExecutor() *V8Isolate {
+	res := &V8Isolate{exec: newExecutor()}
+	res.run(func() {
+		res.v8isolate = C.v8_create_isolate()
+	})
+	runtime.SetFinalizer(res, func(i *V8Isolate) {
+		i.run(func() {
+			C.v8_release_isolate(i.v8isolate)
+		})
+		i.exec.stop()
+	})
+	return res
+}
 
-	snapshot := C.v8_create_snapshot(jsCstr)
-	if snapshot == nil {
-		return nil, errors.New("Unable to create snapshot from provided javascript")
+// run executes f on the isolate's executor thread if it has one.  Otherwise f
+// runs on the calling goroutine, locked to its current OS thread.
+func (iso *V8Isolate) run(f func()) {
+	if iso.exec != nil {
+		iso.exec.run(f)
+		return
 	}
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	f()
+}
 
-	res := &V8Isolate{C.v8_create_isolate_with_snapshot(snapshot)}
+func NewIsolateWithSnapshot(js string) (*V8Isolate, error) {
+	snapshot, err := newSnapshot(js)
+	if err != nil {
+		return nil, err
+	}
+	res := &V8Isolate{v8isolate: C.v8_create_isolate_with_snapshot(snapshot)}
 	runtime.SetFinalizer(res, func(i *V8Isolate) {
 		C.v8_release_isolate(i.v8isolate)
 		C.v8_release_snapshot(snapshot)
@@ -302,6 +395,42 @@ func NewIsolateWithSnapshot(js string) (*V8Isolate, error) {
 	return res, nil
 }
 
+// NewIsolateWithSnapshotAndExecutor creates an isolate from a snapshot like
+// NewIsolateWithSnapshot, with an executor thread like NewIsolateWithExecutor.
+func NewIsolateWithSnapshotAndExecutor(js string) (*V8Isolate, error) {
+	snapshot, err := newSnapshot(js)
+	if err != nil {
+		return nil, err
+	}
+	res := &V8Isolate{exec: newExecutor()}
+	res.run(func() {
+		res.v8isolate = C.v8_create_isolate_with_snapshot(snapshot)
+	})
+	runtime.SetFinalizer(res, func(i *V8Isolate) {
+		i.run(func() {
+			C.v8_release_isolate(i.v8isolate)
+			C.v8_release_snapshot(snapshot)
+		})
+		i.exec.stop()
+	})
+	return res, nil
+}
+
+func newSnapshot(js string) (C.SnapshotPtr, error) {
+	if strings.IndexByte(js, 0) >= 0 {
+		// V8 takes the snapshot source as a NUL-terminated string.
+		return nil, errors.New("Unable to create snapshot: javascript contains a NUL byte")
+	}
+	jsCstr := C.CString(js)
+	defer C.free(unsafe.Pointer(jsCstr))
+
+	snapshot := C.v8_create_snapshot(jsCstr)
+	if snapshot == nil {
+		return nil, errors.New("Unable to create snapshot from provided javascript")
+	}
+	return snapshot, nil
+}
+
 // NewContext creates a V8 context in a default isolate
 // and returns a handle to it.
 func NewContext() *V8Context {
@@ -311,18 +440,34 @@ func NewContext() *V8Context {
 // NewContext creates a V8 context in a given isolate
 // and returns a handle to it.
 func NewContextInIsolate(isolate *V8Isolate) *V8Context {
+	return newContext(isolate, nil)
+}
+
+// newContext creates a context with the given options, which may be nil.
+func newContext(isolate *V8Isolate, opts *C.ContextOpts) *V8Context {
 	v := &V8Context{
-		v8context: C.v8_create_context(isolate.v8isolate),
-		v8isolate: isolate,
-		funcs:     make(map[string]Function),
-		rawFuncs:  make(map[string]RawFunction),
-		values:    make(map[*Value]bool),
-		valuesMu:  &sync.Mutex{},
+		v8isolate:    isolate,
+		values:       make(map[*persistent]bool),
+		valuesMu:     &sync.Mutex{},
+		hostFuncs:    make(map[uint32]hostFunc),
+		hostFuncsMu:  &sync.Mutex{},
+		hostFuncRefs: make(map[uint32]int),
+		globalFuncs:  make(map[string]uint32),
+		objects:      make(map[uint64]interface{}),
+		objectsMu:    &sync.Mutex{},
+		wrapProtos:   make(map[reflect.Type]C.PersistentValuePtr),
 	}
 
 	contextsMutex.Lock()
 	highestContextId += 1
 	v.id = highestContextId
+	contextsMutex.Unlock()
+
+	isolate.run(func() {
+		v.v8context = C.v8_create_context(isolate.v8isolate, C.uint(v.id), opts)
+	})
+
+	contextsMutex.Lock()
 	contexts[v.id] = v
 	contextsMutex.Unlock()
 
@@ -334,70 +479,146 @@ func NewContextInIsolate(isolate *V8Isolate) *V8Context {
 
 // Releases the context handle and all the values allocated within the context.
 // NOTE: The context can't be used for anything after this function is called.
-func (v *V8Context) Destroy() error {
-	if v.v8context == nil {
-		return errors.New("Context is uninitialized.")
-	}
-	v.ClearValues()
+func (v *V8Context) Destroy() (err error) {
+	v.exec(func() {
+		if v.v8context == nil {
+			err = ErrContextDestroyed
+			return
+		}
+		v.reportLeaks()
+		v.ClearValues()
+		for t, proto := range v.wrapProtos {
+			C.v8_release_persistent(v.v8context, proto)
+			delete(v.wrapProtos, t)
+		}
+		v.objectsMu.Lock()
+		v.objects = make(map[uint64]interface{})
+		v.objectsMu.Unlock()
 
-	contextsMutex.Lock()
-	delete(contexts, v.id)
-	contextsMutex.Unlock()
+		contextsMutex.Lock()
+		delete(contexts, v.id)
+		contextsMutex.Unlock()
 
-	C.v8_release_context(v.v8context)
-	v.v8context = nil
-	v.v8isolate = nil
-	return nil
+		C.v8_release_context(v.v8context)
+		v.v8context = nil
+	})
+	return err
 }
 
 // Releases all the values allocated in this context.
 func (v *V8Context) ClearValues() error {
-	if v.v8context == nil {
-		panic("Context is uninitialized.")
-	}
-	v.valuesMu.Lock()
-	for val, _ := range v.values {
-		v.releaseValueLocked(val)
-	}
-	v.valuesMu.Unlock()
-	return nil
+	var err error
+	v.exec(func() {
+		if v.v8context == nil {
+			err = ErrContextDestroyed
+			return
+		}
+		v.valuesMu.Lock()
+		for p, _ := range v.values {
+			v.releaseLocked(p)
+		}
+		v.finalized = nil
+		v.valuesMu.Unlock()
+	})
+	return err
 }
 
 // Releases the v8 hanle that val points to.
 // NOTE: The val object can't be used after this function is called on it.
 func (v *V8Context) ReleaseValue(val *Value) error {
-	if v.v8context == nil {
-		panic("Context is uninitialized.")
-	}
+	var err error
+	v.exec(func() {
+		if v.v8context == nil {
+			err = ErrContextDestroyed
+			return
+		}
+		if err = val.checkIn(v); err != nil {
+			return
+		}
+		v.valuesMu.Lock()
+		defer v.valuesMu.Unlock()
+		v.releaseLocked(val.persistent)
+	})
+	return err
+}
+
+// SetAutoRelease controls whether Values created from now on are released
+// automatically once the Go garbage collector finds them unreachable.  Values
+// may still be released explicitly, and ClearValues and Destroy release them
+// as usual.
+func (v *V8Context) SetAutoRelease(enabled bool) {
 	v.valuesMu.Lock()
-	defer v.valuesMu.Unlock()
-	if val.ptr == nil {
-		return errors.New("Value has been already released.")
-	}
-	v.releaseValueLocked(val)
-	return nil
+	v.autoRelease = enabled
+	v.valuesMu.Unlock()
 }
 
 // Dispose of the persistent object and free the allocated handle.
-func (v *V8Context) releaseValueLocked(val *Value) {
-	val.ctx = nil
-	delete(v.values, val)
-	C.v8_release_persistent(v.v8context, val.ptr)
+func (v *V8Context) releaseLocked(p *persistent) {
+	delete(v.values, p)
+	C.v8_release_persistent(v.v8context, p.ptr)
+	p.ptr = nil
+	v.stats.Released++
+}
+
+// releaseFinalized releases the handles of Values collected by the GC.
+func (v *V8Context) releaseFinalized() {
+	v.valuesMu.Lock()
+	defer v.valuesMu.Unlock()
+	if v.v8context == nil {
+		return
+	}
+	for _, p := range v.finalized {
+		if p.ptr != nil {
+			v.releaseLocked(p)
+		}
+	}
+	v.finalized = nil
 }
 
 func (v *V8Context) newValue(ptr C.PersistentValuePtr) *Value {
-	res := &Value{ptr, v}
+	res := &Value{&persistent{ptr: ptr}, v}
 	v.valuesMu.Lock()
-	v.values[res] = true
+	v.values[res.persistent] = true
+	v.countNewLocked(res.persistent)
+	if n := len(v.scopes); n > 0 {
+		v.scopes[n-1].add(res.persistent)
+	}
+	autoRelease := v.autoRelease
 	v.valuesMu.Unlock()
+	if autoRelease {
+		runtime.SetFinalizer(res, func(val *Value) {
+			// Finalizers run on their own goroutine, which may not use the
+			// isolate: leave the release to the next operation.
+			val.ctx.valuesMu.Lock()
+			val.ctx.finalized = append(val.ctx.finalized, val.persistent)
+			val.ctx.valuesMu.Unlock()
+		})
+	}
 	return res
 }
 
+// exec runs f on a thread that is allowed to use the context's isolate.  See
+// V8Isolate.run.
+func (v *V8Context) exec(f func()) {
+	v.v8isolate.run(func() {
+		v.releaseFinalized()
+		f()
+	})
+}
+
 // Stops the computation running inside the isolate.
 func (iso *V8Isolate) Terminate() {
 	C.v8_terminate(iso.v8isolate)
 }
 
+// collectGarbage runs a full garbage collection, so that the Go values of
+// unreachable JS objects are released.
+func (iso *V8Isolate) collectGarbage() {
+	iso.run(func() {
+		C.v8_collect_garbage(iso.v8isolate)
+	})
+}
+
 // Eval executes the provided javascript within the V8 context.  The javascript
 // is executed as if it was from the specified file, so that any errors or stack
 // traces are annotated with the corresponding file/line number.
@@ -405,88 +626,196 @@ func (iso *V8Isolate) Terminate() {
 // The result of the javascript is returned as POD serialized via JSON and
 // unmarshaled back into Go, otherwise an error is returned.
 func (v *V8Context) Eval(javascript string, filename string) (res interface{}, err error) {
-	if v.v8context == nil {
-		panic("Context is uninitialized.")
-	}
-	runtime.LockOSThread()
-	defer runtime.UnlockOSThread()
-	jsPtr := C.CString(javascript)
-	defer C.free(unsafe.Pointer(jsPtr))
-	var filenamePtr *C.char
+	jsPtr := newCString(javascript)
+	defer freeCString(jsPtr)
+	var filenamePtr C.String
 	if len(filename) > 0 {
-		filenamePtr = C.CString(filename)
-		defer C.free(unsafe.Pointer(filenamePtr))
-	}
-	ret := C.v8_execute(v.v8context, jsPtr, filenamePtr)
-	if ret != nil {
-		out := C.GoString(ret)
-		if out != "" {
-			C.free(unsafe.Pointer(ret))
-			err := json.Unmarshal([]byte(out), &res)
-			return res, err
-		}
-		return out, nil
-	}
-	if C.v8_context_has_terminated(v.v8context) {
-		return "", ErrTerminated
+		filenamePtr = newCString(filename)
+		defer freeCString(filenamePtr)
 	}
-	ret = C.v8_error(v.v8context)
-	out := C.GoString(ret)
-	C.free(unsafe.Pointer(ret))
-	return nil, errors.New(out)
+	v.exec(func() {
+		if v.v8context == nil {
+			err = ErrContextDestroyed
+			return
+		}
+		ret := C.v8_execute(v.v8context, jsPtr, filenamePtr)
+		if ret.ptr != nil {
+			out := takeCString(ret)
+			if out != "" {
+				err = json.Unmarshal([]byte(out), &res)
+				return
+			}
+			res = out
+			return
+		}
+		if C.v8_context_has_terminated(v.v8context) {
+			res, err = "", ErrTerminated
+			return
+		}
+		err = errors.New(takeCString(C.v8_error(v.v8context)))
+	})
+	return res, err
 }
 
-func (v *V8Context) convertToValue(e error) *Value {
-	strdata, err := json.Marshal(e.Error())
-	if err != nil {
-		panic(err)
-	}
-
-	val, err := v.FromJSON(string(strdata))
-	if err != nil {
-		panic(err)
-	}
-	return val
+// Run calls the named function within the v8 context with the specified
+// parameters.  funcname is looked up on the global object and may be a dotted
+// path such as "api.users.get", in which case the function is called with the
+// object holding it as this.  Parameters are converted with ToValue and the
+// result is converted back like Eval's.
+func (v *V8Context) Run(funcname string, args ...interface{}) (interface{}, error) {
+	var res interface{}
+	var err error
+	v.exec(func() {
+		var val *Value
+		if val, err = v.RunRaw(funcname, args...); err != nil {
+			if err == ErrTerminated {
+				res = ""
+			}
+			return
+		}
+		defer v.releaseValues(val)
+		d := v.newDecoder()
+		defer d.release()
+		var ok bool
+		if res, ok, err = d.decodeJSON(val, "", ""); err == nil && !ok {
+			res = ""
+		}
+	})
+	return res, err
 }
 
-func (v *V8Context) throw(err error) {
-	runtime.LockOSThread()
-	defer runtime.UnlockOSThread()
-	msg := C.CString(err.Error())
-	defer C.free(unsafe.Pointer(msg))
-	C.v8_throw(v.v8context, msg)
+// RunRaw is like Run, but returns the result as a Value.
+func (v *V8Context) RunRaw(funcname string, args ...interface{}) (*Value, error) {
+	var res *Value
+	var err error
+	v.exec(func() {
+		if v.v8context == nil {
+			err = ErrContextDestroyed
+			return
+		}
+		var this, fn *Value
+		if this, fn, err = v.lookupFunction(funcname); err != nil {
+			return
+		}
+		defer v.releaseValues(this, fn)
+		var argv []*Value
+		if argv, err = v.toJSArgs(args); err != nil {
+			return
+		}
+		defer v.releaseValues(argv...)
+		res, err = v.Apply(fn, this, argv...)
+	})
+	return res, err
 }
 
-// Call the named function within the v8 context with the specified parameters.
-// Parameters are serialized via JSON.
-func (v *V8Context) Run(funcname string, args ...interface{}) (interface{}, error) {
-	if v.v8context == nil {
-		panic("Context is uninitialized.")
+// lookupFunction resolves the dotted path funcname from the global object,
+// and returns the function along with the object holding it.  It must be
+// called inside exec.
+func (v *V8Context) lookupFunction(funcname string) (this, fn *Value, err error) {
+	names := strings.Split(funcname, ".")
+	this = v.newValue(C.v8_global(v.v8context))
+	for i, name := range names {
+		if i > 0 {
+			switch kind := v.kind(fn); kind {
+			case C.VALUE_UNDEFINED, C.VALUE_NULL, C.VALUE_BOOLEAN, C.VALUE_NUMBER,
+				C.VALUE_STRING, C.VALUE_SYMBOL, C.VALUE_BIGINT:
+				v.releaseValues(this, fn)
+				return nil, nil, fmt.Errorf("Cannot read property '%s' of %s, which is %s",
+					name, strings.Join(names[:i], "."), kindNames[kind])
+			}
+			v.releaseValues(this)
+			this = fn
+		}
+		if fn, err = v.get(this, name); err != nil {
+			v.releaseValues(this)
+			return nil, nil, err
+		}
 	}
+	if v.kind(fn) != C.VALUE_FUNCTION {
+		v.releaseValues(this, fn)
+		return nil, nil, fmt.Errorf("%s is not a function", funcname)
+	}
+	return this, fn, nil
+}
 
-	var cmd bytes.Buffer
+// get returns the named property of obj.  It must be called inside exec.
+func (v *V8Context) get(obj *Value, name string) (*Value, error) {
+	cname := newCString(name)
+	defer freeCString(cname)
+	ptr := C.v8_get(v.v8context, obj.ptr, cname)
+	runtime.KeepAlive(obj)
+	if ptr == nil {
+		if C.v8_context_has_terminated(v.v8context) {
+			return nil, ErrTerminated
+		}
+		return nil, errors.New(takeCString(C.v8_error(v.v8context)))
+	}
+	return v.newValue(ptr), nil
+}
 
-	fmt.Fprint(&cmd, funcname, "(")
-	for i, arg := range args {
-		if i > 0 {
-			fmt.Fprint(&cmd, ",")
+// NewStringUTF16 returns a JS String made of the given UTF-16 code units,
+// which need not be valid UTF-16.
+func (v *V8Context) NewStringUTF16(units []uint16) (*Value, error) {
+	var res *Value
+	var err error
+	v.exec(func() {
+		if v.v8context == nil {
+			err = ErrContextDestroyed
+			return
 		}
-		err := json.NewEncoder(&cmd).Encode(arg)
-		if err != nil {
-			return nil, err
+		var data *C.uint16_t
+		if len(units) > 0 {
+			data = (*C.uint16_t)(unsafe.Pointer(&units[0]))
 		}
-	}
-	fmt.Fprint(&cmd, ")")
-	return v.Eval(cmd.String(), fmt.Sprintf("[RUN:%v]", funcname))
+		ptr := C.v8_new_string_utf16(v.v8context, data, C.int(len(units)))
+		if ptr == nil {
+			err = errors.New("String is too long")
+			return
+		}
+		res = v.newValue(ptr)
+	})
+	return res, err
 }
 
 // FromJSON parses a JSON string and returns a Value that references the parsed
 // data in the V8 context.
 func (v *V8Context) FromJSON(s string) (*Value, error) {
-	if v.v8context == nil {
-		panic("Context is uninitialized.")
-	}
-	return v.EvalRaw("JSON.parse('"+template.JSEscapeString(s)+"')", "FromJSON")
+	return v.ParseJSON([]byte(s))
+}
+
+// Global returns the global object of the context, through which globals
+// may be read, set, deleted and enumerated.
+func (v *V8Context) Global() *Value {
+	var res *Value
+	v.exec(func() {
+		if v.v8context == nil {
+			// Let the Value methods report it.
+			res = &Value{&persistent{}, v}
+			return
+		}
+		res = v.newValue(C.v8_global(v.v8context))
+	})
+	return res
+}
+
+// SetGlobal sets the named global to val, which may be a *Value or a Go
+// value converted with ToValue.
+func (v *V8Context) SetGlobal(name string, val interface{}) error {
+	var err error
+	v.exec(func() {
+		if v.v8context == nil {
+			err = ErrContextDestroyed
+			return
+		}
+		var jsVal *Value
+		if jsVal, err = v.toJS(val); err != nil {
+			return
+		}
+		global := v.newValue(C.v8_global(v.v8context))
+		defer v.releaseValues(jsVal, global)
+		err = global.Set(name, jsVal)
+	})
+	return err
 }
 
 // CreateJS evalutes the specified javascript object and returns a handle to the
@@ -500,9 +829,6 @@ func (v *V8Context) FromJSON(s string) (*Value, error) {
 // The filename parameter may be specified to provide additional debugging in
 // the case of failures.
 func (v *V8Context) CreateJS(js, filename string) (*Value, error) {
-	if v.v8context == nil {
-		panic("Context is uninitialized.")
-	}
 	script := fmt.Sprintf(`(function() { return %s; })()`, js)
 	return v.EvalRaw(script, filename)
 }
@@ -515,66 +841,83 @@ func (v *V8Context) CreateJS(js, filename string) (*Value, error) {
 // engine if it succeeded, otherwise an error is returned.  Unlike Eval, this
 // does not do any JSON marshalling/unmarshalling of the results
 func (ctx *V8Context) EvalRaw(js string, filename string) (*Value, error) {
-	if ctx.v8context == nil {
-		panic("Context is uninitialized.")
-	}
-	runtime.LockOSThread()
-	defer runtime.UnlockOSThread()
-
-	jsPtr := C.CString(js)
-	defer C.free(unsafe.Pointer(jsPtr))
-
-	filenamePtr := C.CString(filename)
-	defer C.free(unsafe.Pointer(filenamePtr))
-
-	ret := C.v8_eval(ctx.v8context, jsPtr, filenamePtr)
-	if ret == nil {
-		if C.v8_context_has_terminated(ctx.v8context) {
-			return nil, ErrTerminated
+	jsPtr := newCString(js)
+	defer freeCString(jsPtr)
+
+	filenamePtr := newCString(filename)
+	defer freeCString(filenamePtr)
+
+	var val *Value
+	var err error
+	ctx.exec(func() {
+		if ctx.v8context == nil {
+			err = ErrContextDestroyed
+			return
 		}
-		err := C.v8_error(ctx.v8context)
-		defer C.free(unsafe.Pointer(err))
-		return nil, fmt.Errorf("Failed to execute JS (%s): %s", filename, C.GoString(err))
-	}
-
-	val := ctx.newValue(ret)
-
-	return val, nil
+		ret := C.v8_eval(ctx.v8context, jsPtr, filenamePtr)
+		if ret == nil {
+			if C.v8_context_has_terminated(ctx.v8context) {
+				err = ErrTerminated
+				return
+			}
+			err = fmt.Errorf("Failed to execute JS (%s): %s", filename, takeCString(C.v8_error(ctx.v8context)))
+			return
+		}
+		val = ctx.newValue(ret)
+	})
+	return val, err
 }
 
 // Apply will execute a JS Function with the specified 'this' context and
 // parameters. If 'this' is nil, then the function is executed in the global
-// scope.  f must be a Value handle that holds a JS function.  Other
-// parameters may be any Value.
+// scope.  f must be a Value handle that holds a JS function, otherwise a
+// *NotCallableError is returned.  Other parameters may be any Value.
 func (ctx *V8Context) Apply(f, this *Value, args ...*Value) (*Value, error) {
-	if ctx.v8context == nil {
-		panic("Context is uninitialized.")
-	}
-	runtime.LockOSThread()
-	defer runtime.UnlockOSThread()
-
-	// always allocate at least one so &argPtrs[0] works.
-	argPtrs := make([]C.PersistentValuePtr, len(args)+1)
-	for i := range args {
-		argPtrs[i] = args[i].ptr
-	}
-	var thisPtr C.PersistentValuePtr
-	if this != nil {
-		thisPtr = this.ptr
-	}
-	ret := C.v8_apply(ctx.v8context, f.ptr, thisPtr, C.int(len(args)), &argPtrs[0])
-	if ret == nil {
-		if C.v8_context_has_terminated(ctx.v8context) {
-			return nil, ErrTerminated
+	var val *Value
+	var err error
+	ctx.exec(func() {
+		if ctx.v8context == nil {
+			err = ErrContextDestroyed
+			return
+		}
+		if err = f.checkIn(ctx); err != nil {
+			return
+		}
+		if kind := ctx.kind(f); kind != C.VALUE_FUNCTION {
+			err = &NotCallableError{Kind: kindNames[kind]}
+			return
+		}
+		// always allocate at least one so &argPtrs[0] works.
+		argPtrs := make([]C.PersistentValuePtr, len(args)+1)
+		for i := range args {
+			if err = args[i].checkIn(ctx); err != nil {
+				return
+			}
+			argPtrs[i] = args[i].ptr
+		}
+		var thisPtr C.PersistentValuePtr
+		if this != nil {
+			if err = this.checkIn(ctx); err != nil {
+				return
+			}
+			thisPtr = this.ptr
 		}
-		err := C.v8_error(ctx.v8context)
-		defer C.free(unsafe.Pointer(err))
-		return nil, errors.New(C.GoString(err))
-	}
-
-	val := ctx.newValue(ret)
 
-	return val, nil
+		ret := C.v8_apply(ctx.v8context, f.ptr, thisPtr, C.int(len(args)), &argPtrs[0])
+		runtime.KeepAlive(f)
+		runtime.KeepAlive(this)
+		runtime.KeepAlive(args)
+		if ret == nil {
+			if C.v8_context_has_terminated(ctx.v8context) {
+				err = ErrTerminated
+				return
+			}
+			err = errors.New(takeCString(C.v8_error(ctx.v8context)))
+			return
+		}
+		val = ctx.newValue(ret)
+	})
+	return val, err
 }
 
 // Terminate forcibly stops execution of a V8 context.  This can be safely run
@@ -586,56 +929,102 @@ func (v *V8Context) Terminate() {
 
 // AddFunc adds a function into the V8 context.
 func (v *V8Context) AddFunc(name string, f Function) error {
-	v.funcs[name] = f
-	jsCall := fmt.Sprintf(`function %v() {
-		  return _go_call(%v, "%v", JSON.stringify([].slice.call(arguments)));
-		}`, name, v.id, name)
-	funcname, filepath, line := funcInfo(f)
-	_, err := v.Eval(jsCall, fmt.Sprintf("native callback to %s [%s:%d]",
-		path.Ext(funcname)[1:], path.Base(filepath), line))
-	return err
+	return v.addGlobalFunction(name, v.jsonFunction(f))
+}
+
+// jsonFunction adapts f to a host function.  Arguments are converted to Go
+// the way JSON.stringify and json.Unmarshal would, but without going through
+// JSON, and the result is converted back with ToValue.
+func (v *V8Context) jsonFunction(f Function) hostFunc {
+	return func(this *Value, args []*Value, construct bool) (*Value, error) {
+		defer v.releaseValues(this)
+		defer v.releaseValues(args...)
+		d := v.newDecoder()
+		defer d.release()
+		argv := make([]interface{}, len(args))
+		for i, arg := range args {
+			var err error
+			if argv[i], _, err = d.decodeJSON(arg, strconv.Itoa(i), fmt.Sprintf("[%d]", i)); err != nil {
+				return nil, err
+			}
+		}
+
+		ret := f(argv...)
+		if ret == nil {
+			return nil, nil
+		}
+		res, err := v.toJS(ret)
+		if err != nil {
+			return nil, err
+		}
+		return v.releaseLater(res), nil
+	}
 }
 
 // AddRawFunc adds a raw function into the V8 context.
 func (v *V8Context) AddRawFunc(name string, f RawFunction) error {
-	v.rawFuncs[name] = f
-	jsCall := fmt.Sprintf(`function %v() {
-			return _go_call_raw(%v, "%v", [].slice.call(arguments));
-		}`, name, v.id, name)
-	funcname, filepath, line := funcInfo(f)
-	_, err := v.Eval(jsCall, fmt.Sprintf("native callback to %s [%s:%d]",
-		path.Ext(funcname)[1:], path.Base(filepath), line))
-	return err
+	return v.addGlobalFunction(name, v.rawFunction(f))
 }
 
 // CreateRawFunc adds a raw function into the V8 context without polluting the
 // namespace.  The only reference to the function is returned as a *v8.Value.
 func (v *V8Context) CreateRawFunc(f RawFunction) (fn *Value, err error) {
-	funcname, filepath, line := funcInfo(f)
-	name := fmt.Sprintf("RawFunc:%s@%s:%d", funcname, path.Base(filepath), line)
-	name = template.JSEscapeString(name)
-	v.rawFuncs[name] = f
-	jscode := fmt.Sprintf(`(function() {
-		return _go_call_raw(%v, "%v", [].slice.call(arguments));
-	})`, v.id, name)
-	return v.EvalRaw(jscode, name)
+	funcname, _, _ := funcInfo(f)
+	name := funcname[strings.LastIndex(funcname, ".")+1:]
+	v.exec(func() {
+		if v.v8context == nil {
+			err = ErrContextDestroyed
+			return
+		}
+		fn, err = v.newHostFunction(name, v.rawFunction(f))
+	})
+	return fn, err
 }
 
-// Attempts to convert a native Go value into a *Value.  If the native
-// value is a RawFunction, it will create a function Value.  Otherwise, the
-// value must be JSON serializable and the corresponding JS object will be
-// constructed.
-// NOTE: If the original object has several references to the same object,
-// in the resulting JS object those references will become independent objects.
-func (v *V8Context) ToValue(val interface{}) (*Value, error) {
-	if fn, isFunction := val.(func(Loc, ...*Value) (*Value, error)); isFunction {
-		return v.CreateRawFunc(fn)
+// rawFunction adapts f to a host function, passing it the location of the
+// calling script.  Arguments are handed to f, which owns them.
+func (v *V8Context) rawFunction(f RawFunction) hostFunc {
+	return func(this *Value, args []*Value, construct bool) (*Value, error) {
+		defer v.releaseValues(this)
+		return f(v.caller(), args...)
 	}
-	data, err := json.Marshal(val)
-	if err != nil {
-		return nil, fmt.Errorf("Cannot marshal value as JSON: %v\nVal: %#v", err, val)
+}
+
+// caller returns the location of the script calling a host function.
+func (v *V8Context) caller() Loc {
+	loc := C.v8_caller(v.v8context)
+	return Loc{
+		Funcname: takeCString(loc.funcname),
+		Filename: takeCString(loc.filename),
+		Line:     int(loc.line),
+		Column:   int(loc.column),
 	}
-	return v.FromJSON(string(data))
+}
+
+// Attempts to convert a native Go value into a *Value.  If the native
+// value is a RawFunction, it will create a function Value.  Otherwise the JS
+// value is built directly from the Go value:
+//   - structs and maps with string keys become objects; struct fields are
+//     named like in Decode, and honor the omitempty option,
+//   - maps with other keys become Maps, and other slices and arrays become
+//     arrays,
+//   - []byte becomes a Uint8Array, time.Time a Date and *big.Int a BigInt,
+//   - types implementing Marshaler convert themselves, types implementing
+//     DynamicObject become dynamic objects, and other types implementing
+//     json.Marshaler are converted from their JSON.
+// Pointers and maps referenced several times become a single JS object
+// referenced several times, so shared references and cycles are kept.
+func (v *V8Context) ToValue(val interface{}) (*Value, error) {
+	var res *Value
+	var err error
+	v.exec(func() {
+		if v.v8context == nil {
+			err = ErrContextDestroyed
+			return
+		}
+		res, err = v.toJS(val)
+	})
+	return res, err
 }
 
 // Given any function, it will return the name (a/b/pkg.name), full filename
@@ -653,9 +1042,16 @@ func funcInfo(function interface{}) (name, filepath string, line int) {
 // the callback is running. You may not call any functions on the context or
 // isolate within the run() function, nor may you interact with any V8 values
 // at all.
+//
+// In an isolate with an executor, the executor thread keeps serving operations
+// from other goroutines while run() executes.
 func (v *V8Context) Unlocked(run func()) {
 	unlocker := C.v8_create_unlocker(v.v8isolate.v8isolate)
 	defer C.v8_release_unlocker(unlocker)
 
+	if e := v.v8isolate.exec; e != nil && e.onThread() {
+		e.unlocked(run)
+		return
+	}
 	run()
 }
@@ -1,8 +1,10 @@
 package v8
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"reflect"
 	"regexp"
 	"runtime"
 	"strings"
@@ -47,9 +49,8 @@ func TestAddFunc(t *testing.T) {
 		return nil
 	})
 
-	_, present := ctx.funcs[logFunc]
-	if !present {
-		t.Error("Expected function %v to be present but was not", logFunc)
+	if res, err := ctx.Eval(`typeof `+logFunc, NO_FILE); err != nil || res != "function" {
+		t.Errorf("Expected function %v to be present but was not", logFunc)
 	}
 
 	ctx.Eval(`
@@ -57,15 +58,151 @@ func TestAddFunc(t *testing.T) {
     `, NO_FILE)
 }
 
+func TestAddFuncConversions(t *testing.T) {
+	ctx := NewContext()
+	var got []interface{}
+	ctx.AddFunc("record", func(args ...interface{}) interface{} {
+		got = args
+		return map[string]interface{}{"count": len(args), "list": []string{"a"}}
+	})
+
+	res, err := ctx.Eval(`
+		var res = record(1, "s", true, null, undefined, NaN,
+			[1, undefined, function() {}],
+			{a: {b: 2}, u: undefined, f: function() {}},
+			new Date(Date.UTC(2020, 0, 2)));
+		[res.count, res.list[0]]`, NO_FILE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []interface{}{9.0, "a"}; !reflect.DeepEqual(res, expected) {
+		t.Errorf("Expected the result %v, got %v", expected, res)
+	}
+	expected := []interface{}{
+		1.0, "s", true, nil, nil, nil,
+		[]interface{}{1.0, nil, nil},
+		map[string]interface{}{"a": map[string]interface{}{"b": 2.0}},
+		"2020-01-02T00:00:00.000Z",
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected the arguments %#v, got %#v", expected, got)
+	}
+}
+
+func TestAddFuncMatchesJSON(t *testing.T) {
+	ctx := NewContext()
+	var native, viaJSON []interface{}
+	ctx.AddFunc("native", func(args ...interface{}) interface{} {
+		native = args
+		return nil
+	})
+	if err := addJSONFunc(ctx, "viaJSON", func(args ...interface{}) interface{} {
+		viaJSON = args
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ctx.Eval(`
+		function Point(x) { this.x = x; }
+		Point.prototype.inherited = 1;
+		function getX() { return x; }`, NO_FILE); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, js := range []string{
+		`new Map([["a", 1]])`,
+		`new Set([1, 2])`,
+		`/re/g`,
+		`new Point(1)`,
+		`({toJSON: function(key) { return "key " + key; }})`,
+		`({a: {toJSON: function(key) { return key; }}, u: {toJSON: function() {}}})`,
+		`[{toJSON: function(key) { return [key]; }}]`,
+		`(function() { var d = new Date(0); d.toJSON = function() { return 1; }; return d; })()`,
+		`new Date(NaN)`,
+		`[1, , 3]`,
+	} {
+		if _, err := ctx.Eval(fmt.Sprintf(`native(%s, 1); viaJSON(%s, 1)`, js, js), NO_FILE); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(native, viaJSON) {
+			t.Errorf("%s: expected %#v, got %#v", js, viaJSON, native)
+		}
+
+		if _, err := ctx.Eval(`var x = `+js, NO_FILE); err != nil {
+			t.Fatal(err)
+		}
+		res, err := ctx.Run("getX")
+		if err != nil {
+			t.Fatal(err)
+		}
+		str, err := ctx.Eval(`JSON.stringify(x)`, NO_FILE)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var expected interface{}
+		json.Unmarshal([]byte(str.(string)), &expected)
+		if !reflect.DeepEqual(res, expected) {
+			t.Errorf("Run %s: expected %#v, got %#v", js, expected, res)
+		}
+	}
+}
+
+// addJSONFunc registers f the way AddFunc used to, with a JS shim that
+// passes the arguments and the result through JSON.
+func addJSONFunc(ctx *V8Context, name string, f Function) error {
+	if err := ctx.AddRawFunc("_json_"+name, func(_ Loc, args ...*Value) (*Value, error) {
+		str, err := args[0].ToString()
+		if err != nil {
+			return nil, err
+		}
+		var argv []interface{}
+		json.Unmarshal([]byte(str), &argv)
+		res, _ := json.Marshal(f(argv...))
+		return ctx.ToValue(string(res))
+	}); err != nil {
+		return err
+	}
+	_, err := ctx.Eval(fmt.Sprintf(`function %s() {
+		return JSON.parse(_json_%s(JSON.stringify([].slice.call(arguments))));
+	}`, name, name), NO_FILE)
+	return err
+}
+
+func benchmarkCallback(b *testing.B, add func(*V8Context, string, Function) error) {
+	ctx := NewContext()
+	err := add(ctx, "metric", func(args ...interface{}) interface{} {
+		return len(args[1].(map[string]interface{}))
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	_, err = ctx.Eval(fmt.Sprintf(`
+		for (var i = 0; i < %d; i++) {
+			metric("requests", {host: "a", path: "/x", status: 200, ms: 1.5});
+		}`, b.N), NO_FILE)
+	if err != nil {
+		b.Fatal(err)
+	}
+}
+
+func BenchmarkAddFunc(b *testing.B) {
+	benchmarkCallback(b, (*V8Context).AddFunc)
+}
+
+func BenchmarkAddFuncThroughJSON(b *testing.B) {
+	benchmarkCallback(b, addJSONFunc)
+}
+
 func v8Recurse(ctx *V8Context, t *testing.T) func(args ...interface{}) interface{} {
 	return func(args ...interface{}) interface{} {
 		arg0 := args[0].(float64)
 		if arg0 > 0 {
-			res, err := ctx.Run("'x' + recurse", arg0-1)
+			res, err := ctx.Run("recurse", arg0-1)
 			if err != nil {
 				t.Fatal(err)
 			}
-			return res.(string)
+			return "x" + res.(string)
 		}
 		return "y"
 	}
@@ -512,6 +649,90 @@ func TestRunFunc(t *testing.T) {
 	}
 }
 
+func TestRunPath(t *testing.T) {
+	ctx := NewContext()
+	_, err := ctx.Eval(`var api = {v1: {name: "v1", "get-user": function(id) { return this.name + ":" + id; }}, n: 1}`, NO_FILE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res, err := ctx.Run("api.v1.get-user", "a'); throw 1; ('"); err != nil {
+		t.Fatal(err)
+	} else if res != "v1:a'); throw 1; ('" {
+		t.Errorf("Expected the holder as this and the argument unchanged, got %q", res)
+	}
+	if res, err := ctx.Run("Math.max", 1, 3, 2); err != nil || res != 3.0 {
+		t.Errorf("Expected 3, got %v, %v", res, err)
+	}
+
+	val, err := ctx.RunRaw("Object.create", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if json := toJsonOrFatal(val, t); json != "{}" {
+		t.Errorf("Expected an empty object, got %s", json)
+	}
+
+	for funcname, msg := range map[string]string{
+		"api.n":         "api.n is not a function",
+		"api.n.x":       "Cannot read property 'x' of api.n, which is number",
+		"api.v2.get":    "Cannot read property 'get' of api.v2, which is undefined",
+		"missing":       "missing is not a function",
+		"api.v1.name.f": "Cannot read property 'f' of api.v1.name, which is string",
+	} {
+		if _, err := ctx.Run(funcname); err == nil || err.Error() != msg {
+			t.Errorf("%s: expected %q, got %v", funcname, msg, err)
+		}
+	}
+	if _, err := ctx.Run("Math.max", make(chan int)); err == nil || !strings.HasPrefix(err.Error(), "argument 1: ") {
+		t.Errorf("Expected an error naming the argument, got %v", err)
+	}
+}
+
+func TestGlobal(t *testing.T) {
+	ctx := NewContext()
+	config := map[string]interface{}{"debug": true, "hosts": []string{"a", "b"}}
+	if err := ctx.SetGlobal("config", config); err != nil {
+		t.Fatal(err)
+	}
+	if res, err := ctx.Eval(`config.debug && config.hosts.join()`, NO_FILE); err != nil || res != "a,b" {
+		t.Errorf("Expected a,b, got %v, %v", res, err)
+	}
+
+	global := ctx.Global()
+	props, err := global.Burst()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := props["config"]; !ok {
+		t.Errorf("Expected config among the globals, got %v", props)
+	}
+	math, err := global.Get("Math")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := math.Get("PI"); err != nil {
+		t.Errorf("Expected to read non-enumerable builtins: %v", err)
+	}
+
+	if err := global.Delete("config"); err != nil {
+		t.Fatal(err)
+	}
+	if res, err := ctx.Eval(`typeof config`, NO_FILE); err != nil || res != "undefined" {
+		t.Errorf("Expected config to be deleted, got %v, %v", res, err)
+	}
+	if _, err := global.Get("config"); err == nil {
+		t.Error("Expected an error reading a deleted global")
+	}
+	if err := global.Delete("undefined"); err == nil {
+		t.Error("Expected an error deleting a non-configurable global")
+	}
+
+	ctx.Destroy()
+	if _, err := ctx.Global().Get("Math"); err != ErrContextDestroyed {
+		t.Errorf("Expected ErrContextDestroyed, got %v", err)
+	}
+}
+
 func TestEvalRaw(t *testing.T) {
 	ctx := NewContext()
 
@@ -1158,3 +1379,187 @@ func TestUnlocker(t *testing.T) {
 		t.Fatalf("Expected ErrTerminated, received %v", ctx1err)
 	}
 }
+
+func TestDestroyedContextErrors(t *testing.T) {
+	ctx := NewContext()
+	val, err := ctx.CreateJS(`{a:1}`, NO_FILE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ctx.Destroy(); err != nil {
+		t.Fatal(err)
+	}
+
+	check := func(what string, err error) {
+		if err != ErrContextDestroyed {
+			t.Errorf("%s: expected ErrContextDestroyed, got %v", what, err)
+		}
+	}
+	_, err = ctx.Eval(`1`, NO_FILE)
+	check("Eval", err)
+	_, err = ctx.EvalRaw(`1`, NO_FILE)
+	check("EvalRaw", err)
+	_, err = ctx.Run("f")
+	check("Run", err)
+	_, err = ctx.FromJSON(`{}`)
+	check("FromJSON", err)
+	_, err = ctx.Apply(val, nil)
+	check("Apply", err)
+	check("AddFunc", ctx.AddFunc("f", func(...interface{}) interface{} { return nil }))
+	check("ClearValues", ctx.ClearValues())
+	check("ReleaseValue", ctx.ReleaseValue(val))
+	check("Destroy", ctx.Destroy())
+	check("Do", ctx.Do(func(*Tx) error { return nil }))
+	_, err = val.ToJSON()
+	check("ToJSON", err)
+	_, err = val.Burst()
+	check("Burst", err)
+	_, err = val.Get("a")
+	check("Get", err)
+	check("Set", val.Set("a", val))
+}
+
+func TestReleasedValueErrors(t *testing.T) {
+	ctx := NewContext()
+	val, err := ctx.CreateJS(`{a:1}`, NO_FILE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := ctx.CreateJS(`{}`, NO_FILE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ctx.ReleaseValue(val); err != nil {
+		t.Fatal(err)
+	}
+
+	check := func(what string, err error) {
+		if err != ErrValueReleased {
+			t.Errorf("%s: expected ErrValueReleased, got %v", what, err)
+		}
+	}
+	_, err = val.ToJSON()
+	check("ToJSON", err)
+	_, err = val.ToString()
+	check("ToString", err)
+	_, err = val.Burst()
+	check("Burst", err)
+	check("Set receiver", val.Set("a", other))
+	check("Set value", other.Set("a", val))
+	_, err = ctx.Apply(val, nil)
+	check("Apply", err)
+	check("ReleaseValue", ctx.ReleaseValue(val))
+
+	ctx.ClearValues()
+	_, err = other.ToJSON()
+	check("ToJSON after ClearValues", err)
+}
+
+func TestCallbackForUnknownContext(t *testing.T) {
+	ctx := NewContext()
+	ctx.AddFunc("f", func(args ...interface{}) interface{} { return nil })
+	ctx.AddRawFunc("raw", func(_ Loc, args ...*Value) (*Value, error) { return nil, nil })
+
+	// Make callbacks find no context for ctx's ID.
+	contextsMutex.Lock()
+	delete(contexts, ctx.id)
+	contextsMutex.Unlock()
+	defer func() {
+		contextsMutex.Lock()
+		contexts[ctx.id] = ctx
+		contextsMutex.Unlock()
+	}()
+
+	res, err := ctx.Eval(`
+		var msg;
+		try { f(); } catch (e) { msg = e.message; }
+		msg`, NO_FILE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != ErrContextDestroyed.Error() {
+		t.Errorf("Expected an exception for the unknown context, got %v", res)
+	}
+
+	_, err = ctx.Eval(`raw()`, NO_FILE)
+	if err == nil || !strings.Contains(err.Error(), ErrContextDestroyed.Error()) {
+		t.Errorf("Expected an exception for the unknown context, got %v", err)
+	}
+}
+
+func TestNilValueErrors(t *testing.T) {
+	var val *Value
+	if _, err := val.Get("a"); err != ErrNilValue {
+		t.Errorf("Get: expected ErrNilValue, got %v", err)
+	}
+	if _, err := val.ToJSON(); err != ErrNilValue {
+		t.Errorf("ToJSON: expected ErrNilValue, got %v", err)
+	}
+	if err := val.Set("a", nil); err != ErrNilValue {
+		t.Errorf("Set: expected ErrNilValue, got %v", err)
+	}
+}
+
+func TestCallbackPlumbingHidden(t *testing.T) {
+	secret := NewContext()
+	calls := 0
+	secret.AddFunc("secret", func(args ...interface{}) interface{} { calls++; return nil })
+
+	ctx := NewContext()
+	ctx.AddFunc("f", func(args ...interface{}) interface{} { return nil })
+	ctx.AddRawFunc("raw", func(_ Loc, args ...*Value) (*Value, error) { return nil, nil })
+	res, err := ctx.Eval(`[typeof _go_call, typeof _go_call_raw, typeof secret, String(f), String(raw)].join()`, NO_FILE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "undefined,undefined,undefined,function f() { [native code] },function raw() { [native code] }"
+	if res != expected {
+		t.Errorf("Expected %s, got %v", expected, res)
+	}
+	if calls != 0 {
+		t.Errorf("Expected the other context's function not to be called, got %d calls", calls)
+	}
+}
+
+// hostFuncStats returns the number of live host functions of ctx and the
+// number of JS functions V8 has released.
+func hostFuncStats(ctx *V8Context) (live, released int) {
+	ctx.hostFuncsMu.Lock()
+	defer ctx.hostFuncsMu.Unlock()
+	return len(ctx.hostFuncs), ctx.releasedHostFuncs
+}
+
+func TestHostFunctionsReleased(t *testing.T) {
+	ctx := NewContext()
+	before, released := hostFuncStats(ctx)
+	for i := 0; i < 10000; i++ {
+		fn, err := ctx.CreateRawFunc(func(_ Loc, args ...*Value) (*Value, error) { return nil, nil })
+		if err != nil {
+			t.Fatal(err)
+		}
+		ctx.ReleaseValue(fn)
+	}
+	ctx.v8isolate.collectGarbage()
+	live, nowReleased := hostFuncStats(ctx)
+	if n := nowReleased - released; n < 9900 {
+		t.Errorf("Expected V8 to collect the functions, %d were released", n)
+	}
+	if n := live - before; n > 100 {
+		t.Errorf("Expected collected functions to be released, %d remain", n)
+	}
+
+	// Rebinding a global reuses its host function.
+	before, _ = hostFuncStats(ctx)
+	for i := 0; i < 10; i++ {
+		n := i
+		if err := ctx.AddFunc("f", func(args ...interface{}) interface{} { return n }); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if live, _ := hostFuncStats(ctx); live-before != 1 {
+		t.Errorf("Expected a single host function for f, got %d", live-before)
+	}
+	if res, err := ctx.Eval(`f()`, NO_FILE); err != nil || res != 9.0 {
+		t.Errorf("Expected the last binding to be called, got %v, %v", res, err)
+	}
+}
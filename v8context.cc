@@ -2,108 +2,431 @@
 
 #include <cstdlib>
 #include <cstring>
+#include <memory>
 #include <sstream>
+#include <type_traits>
+#include <vector>
 
-extern "C" char* _go_v8_callback(unsigned int ctxID, char* name, char* args);
+extern "C" PersistentValuePtr _go_v8_host_call(
+    unsigned int ctxID, unsigned int callbackID, PersistentValuePtr self,
+    int argc, PersistentValuePtr* argv, bool construct, bool* adopted,
+    String* errmsg);
 
-extern "C" PersistentValuePtr _go_v8_callback_raw(
-    unsigned int ctxID, const char* name, const char* callerFuncname,
-    const char* callerFilename, int callerLine, int callerColumn, int argc,
-    PersistentValuePtr* argv);
+extern "C" void _go_v8_release_object(unsigned int ctxID, double handle);
+
+extern "C" void _go_v8_release_host_function(unsigned int ctxID,
+                                             double callbackID);
+
+extern "C" PersistentValuePtr _go_v8_resolve_global(unsigned int ctxID,
+                                                    String name,
+                                                    String* errmsg);
+
+extern "C" PersistentValuePtr _go_v8_property(unsigned int ctxID,
+                                              double handle, PropertyOp op,
+                                              String name,
+                                              PersistentValuePtr value,
+                                              bool* result, bool* adopted,
+                                              String* errmsg);
 
 namespace {
 
-// Calling JSON.stringify on value.
-std::string to_json(v8::Isolate* iso, v8::Local<v8::Value> value) {
+#if V8_MAJOR_VERSION > 6 || (V8_MAJOR_VERSION == 6 && V8_MINOR_VERSION >= 8)
+#define HAVE_BIGINT 1
+#endif
+
+// Stored in the first internal field of objects that stand for Go values.
+int kGoObjectTag;
+
+// Returns a JS string holding a copy of str.
+v8::Local<v8::String> new_string(v8::Isolate* iso, String str) {
+  return v8::String::NewFromUtf8(iso, str.ptr ? str.ptr : "",
+                                 v8::NewStringType::kNormal, str.len)
+      .FromMaybe(v8::String::Empty(iso));
+}
+
+// Returns a copy of str allocated with malloc.
+String copy_string(const std::string& str) {
+  String res;
+  res.len = str.length();
+  res.ptr = static_cast<char*>(malloc(res.len + 1));
+  memcpy(res.ptr, str.data(), res.len);
+  res.ptr[res.len] = '\0';
+  return res;
+}
+
+// Converts value to a string, keeping any NUL characters.
+std::string str(v8::Local<v8::Value> value) {
+  v8::String::Utf8Value s(value);
+  if (*s == NULL) {
+    return "";
+  }
+  return std::string(*s, s.length());
+}
+
+// Converts value to JSON like JSON.stringify would, without going through the
+// global JSON object, which scripts may replace.  gap is used for indentation
+// unless it is empty.  Returns "" if an exception was thrown.
+std::string to_json(v8::Isolate* iso, v8::Local<v8::Value> value,
+                    v8::Local<v8::String> gap = v8::Local<v8::String>()) {
   v8::HandleScope scope(iso);
   v8::TryCatch try_catch;
-  v8::Local<v8::Object> json =
-      v8::Local<v8::Object>::Cast(iso->GetCurrentContext()->Global()->Get(
-          v8::String::NewFromUtf8(iso, "JSON")));
-  v8::Local<v8::Function> func = v8::Local<v8::Function>::Cast(
-      json->GetRealNamedProperty(v8::String::NewFromUtf8(iso, "stringify")));
-  v8::Local<v8::Value> args[1];
-  args[0] = value;
-  v8::Local<v8::Value> call_result = func->Call(iso->GetCurrentContext()->Global(), 1, args);
-  if (call_result.IsEmpty()) {
+  v8::Local<v8::String> json;
+  if (!v8::JSON::Stringify(iso->GetCurrentContext(), value, gap)
+           .ToLocal(&json)) {
     try_catch.ReThrow();
     return "";
   }
-  v8::String::Utf8Value ret(call_result->ToString());
-  return *ret;
+  return str(json);
 }
 
-// Calling JSON.parse on str.
+// Parses str like JSON.parse would, without going through the global JSON
+// object.  Returns an empty handle if an exception was thrown.
 v8::Local<v8::Value> from_json(v8::Isolate* iso, std::string str) {
-  v8::HandleScope scope(iso);
-  v8::TryCatch try_catch;
-  v8::Local<v8::Object> json =
-      v8::Local<v8::Object>::Cast(iso->GetCurrentContext()->Global()->Get(
-          v8::String::NewFromUtf8(iso, "JSON")));
-  v8::Local<v8::Function> func = v8::Local<v8::Function>::Cast(
-      json->GetRealNamedProperty(v8::String::NewFromUtf8(iso, "parse")));
-  v8::Local<v8::Value> args[1];
-  args[0] = v8::String::NewFromUtf8(iso, str.c_str());
-  return func->Call(iso->GetCurrentContext()->Global(), 1, args);
-}
-
-// _go_call is a helper function to call Go functions from within v8.
-void _go_call(const v8::FunctionCallbackInfo<v8::Value>& args) {
-  uint32_t id = args[0]->ToUint32()->Value();
-  v8::String::Utf8Value name(args[1]);
-  v8::String::Utf8Value argv(args[2]);
-  v8::Isolate* iso = args.GetIsolate();
-  v8::HandleScope scope(iso);
-  v8::ReturnValue<v8::Value> ret = args.GetReturnValue();
-  char* retv = _go_v8_callback(id, *name, *argv);
-  if (retv != NULL) {
-    ret.Set(from_json(iso, retv));
-    free(retv);
+  v8::EscapableHandleScope scope(iso);
+  v8::Local<v8::Value> value;
+  if (!v8::JSON::Parse(iso->GetCurrentContext(),
+                       v8::String::NewFromUtf8(iso, str.data(),
+                                               v8::NewStringType::kNormal,
+                                               str.length())
+                           .FromMaybe(v8::String::Empty(iso)))
+           .ToLocal(&value)) {
+    return v8::Local<v8::Value>();
   }
+  return scope.Escape(value);
 }
 
-std::string str(v8::Local<v8::Value> value) {
-  v8::String::Utf8Value s(value);
-  if (s.length() == 0) {
-    return "";
+// Rewrites a value before it goes through v8::JSON::Stringify, to apply the
+// JSONOptions that Stringify cannot express: the allowed fields, cycles and
+// BigInts.  Objects are replaced by plain copies holding their prepared
+// fields, after calling their toJSON method like JSON.stringify would.
+class JSONPreparer {
+ public:
+  JSONPreparer(v8::Isolate* iso, const JSONOptions* opts)
+      : mIsolate(iso), mOpts(opts) {
+    for (int i = 0; i < opts->fields_len; i++) {
+      mFields.push_back(new_string(iso, opts->fields[i]));
+    }
   }
-  return *s;
-}
 
-// _go_call_raw is a helper function to call Go functions from within v8.
-void _go_call_raw(const v8::FunctionCallbackInfo<v8::Value>& args) {
-  v8::Isolate* iso = args.GetIsolate();
-  v8::HandleScope scope(iso);
+  // Sets *out to the prepared value, returns false if an exception was
+  // thrown.
+  bool Prepare(v8::Local<v8::Value> key, v8::Local<v8::Value> value,
+               v8::Local<v8::Value>* out);
+
+ private:
+  bool PrepareArray(v8::Local<v8::Array> arr, v8::Local<v8::Value>* out);
+  bool PrepareObject(v8::Local<v8::Object> obj, v8::Local<v8::Value>* out);
 
-  uint32_t id = args[0]->ToUint32()->Value();
-  v8::String::Utf8Value name(args[1]);
-  v8::Local<v8::Array> hargv = v8::Local<v8::Array>::Cast(args[2]);
+  v8::Isolate* mIsolate;
+  const JSONOptions* mOpts;
+  std::vector<v8::Local<v8::Value> > mFields;
+  // The objects being prepared, to detect cycles.
+  std::vector<v8::Local<v8::Object> > mStack;
+};
 
-  std::string src_file, src_func;
-  int line_number = 0, column = 0;
-  v8::Local<v8::StackTrace> trace(v8::StackTrace::CurrentStackTrace(iso, 2));
-  if (trace->GetFrameCount() == 2) {
-    v8::Local<v8::StackFrame> frame(trace->GetFrame(1));
-    src_file = str(frame->GetScriptName());
-    src_func = str(frame->GetFunctionName());
-    line_number = frame->GetLineNumber();
-    column = frame->GetColumn();
+bool JSONPreparer::Prepare(v8::Local<v8::Value> key,
+                           v8::Local<v8::Value> value,
+                           v8::Local<v8::Value>* out) {
+  v8::Local<v8::Context> context = mIsolate->GetCurrentContext();
+  if (value->IsObject()) {
+    v8::Local<v8::Value> toJSON;
+    if (!v8::Local<v8::Object>::Cast(value)
+             ->Get(context, v8::String::NewFromUtf8(mIsolate, "toJSON"))
+             .ToLocal(&toJSON)) {
+      return false;
+    }
+    if (toJSON->IsFunction()) {
+      v8::Local<v8::Value> argv[1] = {key};
+      if (!v8::Local<v8::Function>::Cast(toJSON)
+               ->Call(context, value, 1, argv)
+               .ToLocal(&value)) {
+        return false;
+      }
+    }
+  }
+#ifdef HAVE_BIGINT
+  if (mOpts->bigint_as_string &&
+      (value->IsBigInt() || value->IsBigIntObject())) {
+    v8::Local<v8::String> digits;
+    if (!value->ToString(context).ToLocal(&digits)) {
+      return false;
+    }
+    *out = digits;
+    return true;
+  }
+#endif
+  if (!value->IsObject() || value->IsFunction() || value->IsNumberObject() ||
+      value->IsStringObject() || value->IsBooleanObject()) {
+    *out = value;
+    return true;
   }
 
-  int argc = hargv->Length();
-  PersistentValuePtr argv[argc];
-  for (int i = 0; i < argc; i++) {
-    argv[i] = new v8::Persistent<v8::Value>(iso, hargv->Get(i));
+  v8::Local<v8::Object> obj = v8::Local<v8::Object>::Cast(value);
+  for (size_t i = 0; i < mStack.size(); i++) {
+    if (mStack[i]->StrictEquals(obj)) {
+      if (mOpts->break_cycles) {
+        *out = new_string(mIsolate, mOpts->cycle_placeholder);
+      } else {
+        // Leave the cycle in, for Stringify to report it.
+        *out = value;
+      }
+      return true;
+    }
   }
+  mStack.push_back(obj);
+  bool ok = value->IsArray()
+                ? PrepareArray(v8::Local<v8::Array>::Cast(value), out)
+                : PrepareObject(obj, out);
+  mStack.pop_back();
+  return ok;
+}
 
-  PersistentValuePtr retv =
-      _go_v8_callback_raw(id, *name, src_func.c_str(), src_file.c_str(),
-                          line_number, column, argc, argv);
+bool JSONPreparer::PrepareArray(v8::Local<v8::Array> arr,
+                                v8::Local<v8::Value>* out) {
+  v8::Local<v8::Context> context = mIsolate->GetCurrentContext();
+  v8::Local<v8::Array> res = v8::Array::New(mIsolate, arr->Length());
+  for (uint32_t i = 0; i < arr->Length(); i++) {
+    v8::Local<v8::Value> item;
+    if (!arr->Get(context, i).ToLocal(&item) ||
+        !Prepare(v8::Integer::NewFromUnsigned(mIsolate, i)->ToString(), item,
+                 &item) ||
+        res->Set(context, i, item).IsNothing()) {
+      return false;
+    }
+  }
+  *out = res;
+  return true;
+}
 
-  if (retv == NULL) {
-    args.GetReturnValue().Set(v8::Undefined(iso));
+bool JSONPreparer::PrepareObject(v8::Local<v8::Object> obj,
+                                 v8::Local<v8::Value>* out) {
+  v8::Local<v8::Context> context = mIsolate->GetCurrentContext();
+  std::vector<v8::Local<v8::Value> > keys;
+  if (mOpts->fields_len >= 0) {
+    keys = mFields;
   } else {
-    args.GetReturnValue().Set(*static_cast<v8::Persistent<v8::Value>*>(retv));
+    v8::Local<v8::Array> names;
+    if (!obj->GetOwnPropertyNames(context).ToLocal(&names)) {
+      return false;
+    }
+    for (uint32_t i = 0; i < names->Length(); i++) {
+      keys.push_back(names->Get(i));
+    }
+  }
+
+  v8::Local<v8::Object> res = v8::Object::New(mIsolate);
+  for (size_t i = 0; i < keys.size(); i++) {
+    v8::Local<v8::Value> item;
+    if (!obj->Get(context, keys[i]).ToLocal(&item) ||
+        !Prepare(keys[i], item, &item) ||
+        res->Set(context, keys[i], item).IsNothing()) {
+      return false;
+    }
+  }
+  *out = res;
+  return true;
+}
+
+// Throws errmsg as a JS Error and frees it.
+void throw_and_free(v8::Isolate* iso, String errmsg) {
+  iso->ThrowException(v8::Exception::Error(new_string(iso, errmsg)));
+  free(errmsg.ptr);
+}
+
+// Returns a String pointing into str, which must outlive it.
+String as_string(const std::string& str) {
+  String res;
+  res.ptr = const_cast<char*>(str.data());
+  res.len = str.length();
+  return res;
+}
+
+// Calls back into Go for an interceptor of a dynamic object, created by
+// V8Context::NewDynamicObject.  value is the new value for PROPERTY_SET, and
+// may be empty otherwise.  Sets *result for PROPERTY_QUERY and
+// PROPERTY_DELETE.  Returns the result of PROPERTY_GET and the
+// PROPERTY_*KEYS operations, or NULL if there is none.  On errors, throws,
+// sets *failed and returns NULL.
+template <typename T>
+PersistentValuePtr call_dynamic(const v8::PropertyCallbackInfo<T>& info,
+                                PropertyOp op, const std::string& name,
+                                v8::Local<v8::Value> value, bool* result,
+                                bool* failed) {
+  v8::Isolate* iso = info.GetIsolate();
+  v8::Local<v8::Context> context = iso->GetCurrentContext();
+  uint32_t ctxID = info.Data()->Uint32Value(context).FromJust();
+  double handle =
+      info.Holder()->GetInternalField(1)->NumberValue(context).FromJust();
+
+  PersistentValuePtr pvalue = NULL;
+  if (!value.IsEmpty()) {
+    pvalue = new v8::Persistent<v8::Value>(iso, value);
+  }
+  bool adopted = false;
+  String errmsg = {NULL, 0};
+  PersistentValuePtr res = _go_v8_property(
+      ctxID, handle, op, as_string(name), pvalue, result, &adopted, &errmsg);
+  if (!adopted && pvalue != NULL) {
+    v8::Persistent<v8::Value>* p =
+        static_cast<v8::Persistent<v8::Value>*>(pvalue);
+    p->Reset();
+    delete p;
+  }
+
+  *failed = errmsg.ptr != NULL;
+  if (*failed) {
+    throw_and_free(iso, errmsg);
+    return NULL;
+  }
+  return res;
+}
+
+std::string index_name(uint32_t index) {
+  std::stringstream ss;
+  ss << index;
+  return ss.str();
+}
+
+void dynamic_get(const std::string& name,
+                 const v8::PropertyCallbackInfo<v8::Value>& info) {
+  bool result = false, failed = false;
+  PersistentValuePtr res = call_dynamic(info, PROPERTY_GET, name,
+                                        v8::Local<v8::Value>(), &result,
+                                        &failed);
+  if (res != NULL) {
+    info.GetReturnValue().Set(
+        static_cast<v8::Persistent<v8::Value>*>(res)->Get(info.GetIsolate()));
+  }
+}
+
+void dynamic_set(const std::string& name, v8::Local<v8::Value> value,
+                 const v8::PropertyCallbackInfo<v8::Value>& info) {
+  bool result = false, failed = false;
+  call_dynamic(info, PROPERTY_SET, name, value, &result, &failed);
+  if (!failed) {
+    // Intercepted: V8 must not store the value itself.
+    info.GetReturnValue().Set(value);
+  }
+}
+
+void dynamic_query(const std::string& name,
+                   const v8::PropertyCallbackInfo<v8::Integer>& info) {
+  bool result = false, failed = false;
+  call_dynamic(info, PROPERTY_QUERY, name, v8::Local<v8::Value>(), &result,
+               &failed);
+  if (result) {
+    info.GetReturnValue().Set(static_cast<int32_t>(v8::None));
+  }
+}
+
+void dynamic_delete(const std::string& name,
+                    const v8::PropertyCallbackInfo<v8::Boolean>& info) {
+  bool result = false, failed = false;
+  call_dynamic(info, PROPERTY_DELETE, name, v8::Local<v8::Value>(), &result,
+               &failed);
+  if (!failed) {
+    info.GetReturnValue().Set(result);
+  }
+}
+
+void dynamic_keys(PropertyOp op,
+                  const v8::PropertyCallbackInfo<v8::Array>& info) {
+  bool result = false, failed = false;
+  PersistentValuePtr res = call_dynamic(info, op, "", v8::Local<v8::Value>(),
+                                        &result, &failed);
+  if (res != NULL) {
+    v8::Local<v8::Value> keys =
+        static_cast<v8::Persistent<v8::Value>*>(res)->Get(info.GetIsolate());
+    if (keys->IsArray()) {
+      info.GetReturnValue().Set(v8::Local<v8::Array>::Cast(keys));
+    }
+  }
+}
+
+// The named property interceptors of dynamic objects.  Symbols are left to
+// the object itself.
+void dynamic_named_getter(v8::Local<v8::Name> property,
+                          const v8::PropertyCallbackInfo<v8::Value>& info) {
+  if (!property->IsSymbol()) {
+    dynamic_get(str(property), info);
+  }
+}
+
+void dynamic_named_setter(v8::Local<v8::Name> property,
+                          v8::Local<v8::Value> value,
+                          const v8::PropertyCallbackInfo<v8::Value>& info) {
+  if (!property->IsSymbol()) {
+    dynamic_set(str(property), value, info);
+  }
+}
+
+void dynamic_named_query(v8::Local<v8::Name> property,
+                         const v8::PropertyCallbackInfo<v8::Integer>& info) {
+  if (!property->IsSymbol()) {
+    dynamic_query(str(property), info);
+  }
+}
+
+void dynamic_named_deleter(v8::Local<v8::Name> property,
+                           const v8::PropertyCallbackInfo<v8::Boolean>& info) {
+  if (!property->IsSymbol()) {
+    dynamic_delete(str(property), info);
+  }
+}
+
+void dynamic_named_enumerator(const v8::PropertyCallbackInfo<v8::Array>& info) {
+  dynamic_keys(PROPERTY_KEYS, info);
+}
+
+// The indexed property interceptors of dynamic objects, which pass indices
+// to Go as decimal strings.
+void dynamic_indexed_getter(uint32_t index,
+                            const v8::PropertyCallbackInfo<v8::Value>& info) {
+  dynamic_get(index_name(index), info);
+}
+
+void dynamic_indexed_setter(uint32_t index, v8::Local<v8::Value> value,
+                            const v8::PropertyCallbackInfo<v8::Value>& info) {
+  dynamic_set(index_name(index), value, info);
+}
+
+void dynamic_indexed_query(uint32_t index,
+                           const v8::PropertyCallbackInfo<v8::Integer>& info) {
+  dynamic_query(index_name(index), info);
+}
+
+void dynamic_indexed_deleter(uint32_t index,
+                             const v8::PropertyCallbackInfo<v8::Boolean>& info) {
+  dynamic_delete(index_name(index), info);
+}
+
+void dynamic_indexed_enumerator(
+    const v8::PropertyCallbackInfo<v8::Array>& info) {
+  dynamic_keys(PROPERTY_INDEX_KEYS, info);
+}
+
+// The interceptor of the global object for ContextOpts.global_resolver.  It
+// does not mask the global's own properties, so it only sees the names that
+// are defined nowhere else.
+void resolve_global(v8::Local<v8::Name> property,
+                    const v8::PropertyCallbackInfo<v8::Value>& info) {
+  if (property->IsSymbol()) {
+    return;
+  }
+  v8::Isolate* iso = info.GetIsolate();
+  uint32_t ctxID =
+      info.Data()->Uint32Value(iso->GetCurrentContext()).FromJust();
+  std::string name = str(property);
+  String errmsg = {NULL, 0};
+  PersistentValuePtr res =
+      _go_v8_resolve_global(ctxID, as_string(name), &errmsg);
+  if (errmsg.ptr != NULL) {
+    throw_and_free(iso, errmsg);
+    return;
+  }
+  if (res != NULL) {
+    info.GetReturnValue().Set(
+        static_cast<v8::Persistent<v8::Value>*>(res)->Get(iso));
   }
 }
 };
@@ -133,30 +456,157 @@ class ErrorReporter {
   bool *mTerminated;
 };
 
-V8Context::V8Context(v8::Isolate* isolate) : mIsolate(isolate), mTerminated(false) {
+// Holds the isolate lock for V8Context::Enter/Exit.
+struct V8Context::Scope {
+  explicit Scope(v8::Isolate* isolate)
+      : locker(isolate),
+        isolate_scope(isolate),
+        thread(std::this_thread::get_id()) {}
+
+  v8::Locker locker;
+  v8::Isolate::Scope isolate_scope;
+  std::thread::id thread;
+};
+
+// Locks and enters the isolate for the duration of an operation, unless the
+// calling thread already holds it between Enter and Exit.  A thread that
+// entered but then unlocked the isolate, see Unlocked in Go, may run other
+// operations meanwhile, e.g. on an executor: those lock as usual.
+class V8Context::Lock {
+ public:
+  explicit Lock(V8Context* context)
+      : mOwned(context->mTxThread.load() != std::this_thread::get_id() ||
+               !v8::Locker::IsLocked(context->mIsolate)) {
+    if (mOwned) {
+      new (&mScope) Scope(context->mIsolate);
+    }
+  }
+
+  ~Lock() {
+    if (mOwned) {
+      reinterpret_cast<Scope*>(&mScope)->~Scope();
+    }
+  }
+
+ private:
+  bool mOwned;
+  std::aligned_storage<sizeof(Scope), alignof(Scope)>::type mScope;
+};
+
+// A weak reference to an object standing for a Go value.
+struct V8Context::WeakGoObject {
+  WeakGoObject(V8Context* context, double handle,
+               void (*release)(unsigned int, double))
+      : context(context), handle(handle), release(release) {}
+
+  V8Context* context;
+  double handle;
+  // Called with the context ID and handle once object is collected.
+  void (*release)(unsigned int, double);
+  v8::Persistent<v8::Object> object;
+};
+
+V8Context::V8Context(v8::Isolate* isolate, unsigned int id,
+                     const ContextOpts* opts)
+    : mId(id),
+      mIsolate(isolate),
+      mTxThread(std::thread::id()),
+      mTerminated(false) {
   v8::Locker lock(mIsolate);
   v8::Isolate::Scope isolate_scope(mIsolate);
   v8::HandleScope handle_scope(mIsolate);
 
   v8::V8::SetCaptureStackTraceForUncaughtExceptions(true);
 
-  v8::Local<v8::ObjectTemplate> globals = v8::ObjectTemplate::New(mIsolate);
-  globals->Set(v8::String::NewFromUtf8(mIsolate, "_go_call"),
-               v8::FunctionTemplate::New(mIsolate, _go_call));
-  globals->Set(v8::String::NewFromUtf8(mIsolate, "_go_call_raw"),
-               v8::FunctionTemplate::New(mIsolate, _go_call_raw));
+  // The global object is built from a function template, so that it can be
+  // named and so that it has a prototype of its own, see SetGlobalPrototype.
+  v8::Local<v8::FunctionTemplate> global = v8::FunctionTemplate::New(mIsolate);
+  if (opts != NULL && opts->global_name.len > 0) {
+    global->SetClassName(new_string(mIsolate, opts->global_name));
+  }
+  v8::Local<v8::ObjectTemplate> globals = global->InstanceTemplate();
+  if (opts != NULL && opts->global_resolver) {
+    globals->SetHandler(v8::NamedPropertyHandlerConfiguration(
+        resolve_global, NULL, NULL, NULL, NULL,
+        v8::Integer::NewFromUnsigned(mIsolate, mId),
+        v8::PropertyHandlerFlags::kNonMasking));
+  }
 
   mContext.Reset(mIsolate, v8::Context::New(mIsolate, NULL, globals));
+
+  {
+    v8::Local<v8::Context> context = mContext.Get(mIsolate);
+    v8::Context::Scope context_scope(context);
+    if (opts != NULL && opts->disallow_code_generation) {
+      context->AllowCodeGenerationFromStrings(false);
+    }
+    v8::Local<v8::Object> object = v8::Local<v8::Object>::Cast(
+        context->Global()->Get(v8::String::NewFromUtf8(mIsolate, "Object")));
+    mPreventExtensions.Reset(
+        mIsolate, v8::Local<v8::Function>::Cast(object->Get(
+                      v8::String::NewFromUtf8(mIsolate, "preventExtensions"))));
+  }
+
+  v8::Local<v8::ObjectTemplate> go_object = v8::ObjectTemplate::New(mIsolate);
+  go_object->SetInternalFieldCount(2);
+  mGoObjectTemplate.Reset(mIsolate, go_object);
+
+  v8::Local<v8::ObjectTemplate> dynamic = v8::ObjectTemplate::New(mIsolate);
+  dynamic->SetInternalFieldCount(2);
+  v8::Local<v8::Value> data = v8::Integer::NewFromUnsigned(mIsolate, mId);
+  dynamic->SetHandler(v8::NamedPropertyHandlerConfiguration(
+      dynamic_named_getter, dynamic_named_setter, dynamic_named_query,
+      dynamic_named_deleter, dynamic_named_enumerator, data));
+  dynamic->SetHandler(v8::IndexedPropertyHandlerConfiguration(
+      dynamic_indexed_getter, dynamic_indexed_setter, dynamic_indexed_query,
+      dynamic_indexed_deleter, dynamic_indexed_enumerator, data));
+  mDynamicObjectTemplate.Reset(mIsolate, dynamic);
 };
 
 V8Context::~V8Context() {
   v8::Locker lock(mIsolate);
+  for (std::set<WeakGoObject*>::iterator it = mGoObjects.begin();
+       it != mGoObjects.end(); ++it) {
+    (*it)->object.Reset();
+    delete *it;
+  }
+  mGoObjectTemplate.Reset();
+  mDynamicObjectTemplate.Reset();
+  mPreventExtensions.Reset();
   mContext.Reset();
 };
 
-char* V8Context::Execute(const char* source, const char* filename) {
-  v8::Locker locker(mIsolate);
-  v8::Isolate::Scope isolate_scope(mIsolate);
+void V8Context::Enter() {
+  mScopes.push_back(new Scope(mIsolate));
+  mTxThread = mScopes.back()->thread;
+  v8::HandleScope handle_scope(mIsolate);
+  mContext.Get(mIsolate)->Enter();
+}
+
+void V8Context::Exit() {
+  {
+    v8::HandleScope handle_scope(mIsolate);
+    mContext.Get(mIsolate)->Exit();
+  }
+  // Scopes of other threads remain when this one entered while they were
+  // unlocked, see Unlocked in Go, and may have been pushed after this
+  // thread's own.
+  std::thread::id self = std::this_thread::get_id();
+  std::vector<Scope*>::iterator it = mScopes.end();
+  while (it != mScopes.begin() && (*(it - 1))->thread != self) {
+    --it;
+  }
+  if (it == mScopes.begin()) {
+    return;
+  }
+  Scope* scope = *(it - 1);
+  mScopes.erase(it - 1);
+  mTxThread = mScopes.empty() ? std::thread::id() : mScopes.back()->thread;
+  delete scope;
+}
+
+String V8Context::Execute(String source, String filename) {
+  Lock lock(this);
   v8::HandleScope handle_scope(mIsolate);
   v8::Context::Scope context_scope(mContext.Get(mIsolate));
   v8::TryCatch try_catch;
@@ -164,34 +614,35 @@ char* V8Context::Execute(const char* source, const char* filename) {
 
   ErrorReporter er(mIsolate, &try_catch, &mLastError, &mTerminated);
 
+  String none = {NULL, 0};
   v8::Local<v8::Script> script = v8::Script::Compile(
-      v8::String::NewFromUtf8(mIsolate, source),
-      v8::String::NewFromUtf8(mIsolate, filename ? filename : "undefined"));
+      new_string(mIsolate, source),
+      filename.ptr ? new_string(mIsolate, filename)
+                   : v8::String::NewFromUtf8(mIsolate, "undefined"));
 
   if (script.IsEmpty()) {
-    return NULL;
+    return none;
   }
 
   v8::Local<v8::Value> result = script->Run();
 
   if (result.IsEmpty()) {
-    return NULL;
+    return none;
   }
 
   if (result->IsFunction() || result->IsUndefined()) {
-    return strdup("");
+    return copy_string("");
   } else {
     std::string json = to_json(mIsolate, result);
     if (json == "") {
-      return NULL;
+      return none;
     }
-    return strdup(json.c_str());
+    return copy_string(json);
   }
 }
 
-PersistentValuePtr V8Context::Eval(const char* source, const char* filename) {
-  v8::Locker locker(mIsolate);
-  v8::Isolate::Scope isolate_scope(mIsolate);
+PersistentValuePtr V8Context::Eval(String source, String filename) {
+  Lock lock(this);
   v8::HandleScope handle_scope(mIsolate);
   v8::Context::Scope context_scope(mContext.Get(mIsolate));
   v8::TryCatch try_catch;
@@ -200,9 +651,9 @@ PersistentValuePtr V8Context::Eval(const char* source, const char* filename) {
   ErrorReporter er(mIsolate, &try_catch, &mLastError, &mTerminated);
 
   v8::Local<v8::Script> script = v8::Script::Compile(
-      v8::String::NewFromUtf8(mIsolate, source),
-      filename ? v8::String::NewFromUtf8(mIsolate, filename)
-               : v8::String::NewFromUtf8(mIsolate, "undefined"));
+      new_string(mIsolate, source),
+      filename.ptr ? new_string(mIsolate, filename)
+                   : v8::String::NewFromUtf8(mIsolate, "undefined"));
 
   if (script.IsEmpty()) {
     return NULL;
@@ -220,8 +671,7 @@ PersistentValuePtr V8Context::Eval(const char* source, const char* filename) {
 PersistentValuePtr V8Context::Apply(PersistentValuePtr func,
                                     PersistentValuePtr self, int argc,
                                     PersistentValuePtr* argv) {
-  v8::Locker locker(mIsolate);
-  v8::Isolate::Scope isolate_scope(mIsolate);
+  Lock lock(this);
   v8::HandleScope handle_scope(mIsolate);
   v8::Context::Scope context_scope(mContext.Get(mIsolate));
   v8::TryCatch try_catch;
@@ -231,6 +681,10 @@ PersistentValuePtr V8Context::Apply(PersistentValuePtr func,
 
   v8::Local<v8::Value> pfunc =
       static_cast<v8::Persistent<v8::Value>*>(func)->Get(mIsolate);
+  if (!pfunc->IsFunction()) {
+    mLastError = "The supplied value is not a function.";
+    return NULL;
+  }
   v8::Local<v8::Function> vfunc = v8::Local<v8::Function>::Cast(pfunc);
 
   v8::Local<v8::Value>* vargs = new v8::Local<v8::Value>[argc];
@@ -239,16 +693,15 @@ PersistentValuePtr V8Context::Apply(PersistentValuePtr func,
   }
 
   // Global scope requested?
-  v8::Local<v8::Object> vself;
+  v8::Local<v8::Value> vself;
   if (self == NULL) {
     vself = mContext.Get(mIsolate)->Global();
   } else {
-    v8::Local<v8::Value> pself =
-        static_cast<v8::Persistent<v8::Value>*>(self)->Get(mIsolate);
-    vself = v8::Local<v8::Object>::Cast(pself);
+    vself = static_cast<v8::Persistent<v8::Value>*>(self)->Get(mIsolate);
   }
 
-  v8::Local<v8::Value> result = vfunc->Call(vself, argc, vargs);
+  v8::Local<v8::Value> result;
+  vfunc->Call(mContext.Get(mIsolate), vself, argc, vargs).ToLocal(&result);
 
   delete[] vargs;
 
@@ -259,42 +712,116 @@ PersistentValuePtr V8Context::Apply(PersistentValuePtr func,
   return new v8::Persistent<v8::Value>(mIsolate, result);
 }
 
-char* V8Context::PersistentToJSON(PersistentValuePtr persistent) {
-  v8::Locker locker(mIsolate);
-  v8::Isolate::Scope isolate_scope(mIsolate);
+PersistentValuePtr V8Context::New(PersistentValuePtr func, int argc,
+                                  PersistentValuePtr* argv) {
+  Lock lock(this);
+  v8::HandleScope handle_scope(mIsolate);
+  v8::Context::Scope context_scope(mContext.Get(mIsolate));
+  v8::TryCatch try_catch;
+  try_catch.SetVerbose(false);
+
+  ErrorReporter er(mIsolate, &try_catch, &mLastError, &mTerminated);
+
+  v8::Local<v8::Value> pfunc =
+      static_cast<v8::Persistent<v8::Value>*>(func)->Get(mIsolate);
+  if (!pfunc->IsFunction()) {
+    mLastError = "The supplied value is not a function.";
+    return NULL;
+  }
+  v8::Local<v8::Function> vfunc = v8::Local<v8::Function>::Cast(pfunc);
+
+  v8::Local<v8::Value>* vargs = new v8::Local<v8::Value>[argc];
+  for (int i = 0; i < argc; i++) {
+    vargs[i] = static_cast<v8::Persistent<v8::Value>*>(argv[i])->Get(mIsolate);
+  }
+
+  v8::Local<v8::Object> result;
+  vfunc->NewInstance(mContext.Get(mIsolate), argc, vargs).ToLocal(&result);
+
+  delete[] vargs;
+
+  if (result.IsEmpty()) {
+    return NULL;
+  }
+
+  return new v8::Persistent<v8::Value>(mIsolate, result);
+}
+
+String V8Context::ToJSON(PersistentValuePtr persistent,
+                         const JSONOptions* opts) {
+  Lock lock(this);
   v8::HandleScope handle_scope(mIsolate);
   v8::Context::Scope context_scope(mContext.Get(mIsolate));
   v8::TryCatch try_catch;
-  v8::Local<v8::Value> persist =
+  v8::Local<v8::Value> value =
       static_cast<v8::Persistent<v8::Value>*>(persistent)->Get(mIsolate);
 
   ErrorReporter er(mIsolate, &try_catch, &mLastError, &mTerminated);
 
-  std::string json_str = to_json(mIsolate, persist);
+  String none = {NULL, 0};
+  v8::Local<v8::String> gap;
+  if (opts != NULL) {
+    if (opts->indent.len > 0) {
+      gap = new_string(mIsolate, opts->indent);
+    }
+    if (opts->fields_len >= 0 || opts->break_cycles ||
+        opts->bigint_as_string) {
+      JSONPreparer preparer(mIsolate, opts);
+      if (!preparer.Prepare(v8::String::Empty(mIsolate), value, &value)) {
+        return none;
+      }
+    }
+  }
+
+  std::string json_str = to_json(mIsolate, value, gap);
   if (json_str == "") {
+    return none;
+  }
+  return copy_string(json_str);
+}
+
+PersistentValuePtr V8Context::ParseJSON(String data) {
+  Lock lock(this);
+  v8::HandleScope handle_scope(mIsolate);
+  v8::Context::Scope context_scope(mContext.Get(mIsolate));
+  v8::TryCatch try_catch;
+  try_catch.SetVerbose(false);
+
+  ErrorReporter er(mIsolate, &try_catch, &mLastError, &mTerminated);
+
+  v8::Local<v8::Value> value =
+      from_json(mIsolate, std::string(data.ptr ? data.ptr : "", data.len));
+  if (value.IsEmpty()) {
     return NULL;
   }
-  return strdup(json_str.c_str());
+  return new v8::Persistent<v8::Value>(mIsolate, value);
 }
 
 void V8Context::ReleasePersistent(PersistentValuePtr persistent) {
-  v8::Locker locker(mIsolate);
+  Lock lock(this);
   v8::Persistent<v8::Value>* persist =
       static_cast<v8::Persistent<v8::Value>*>(persistent);
   persist->Reset();
   delete persist;
 }
 
+PersistentValuePtr V8Context::CopyPersistent(PersistentValuePtr persistent) {
+  Lock lock(this);
+  v8::HandleScope handle_scope(mIsolate);
+
+  return new v8::Persistent<v8::Value>(
+      mIsolate, static_cast<v8::Persistent<v8::Value>*>(persistent)->Get(mIsolate));
+}
+
 const char* V8Context::SetPersistentField(PersistentValuePtr persistent,
-                                          const char* field,
+                                          String field,
                                           PersistentValuePtr value) {
-  v8::Locker locker(mIsolate);
-  v8::Isolate::Scope isolate_scope(mIsolate);
+  Lock lock(this);
   v8::HandleScope handle_scope(mIsolate);
   v8::Context::Scope context_scope(mContext.Get(mIsolate));
   v8::Persistent<v8::Value>* persist =
       static_cast<v8::Persistent<v8::Value>*>(persistent);
-  v8::Local<v8::Value> name(v8::String::NewFromUtf8(mIsolate, field));
+  v8::Local<v8::Value> name(new_string(mIsolate, field));
 
   // Create the local object now, but reset the persistent one later:
   // we could still fail setting the value, and then there is no point
@@ -326,8 +853,7 @@ const char* V8Context::SetPersistentField(PersistentValuePtr persistent,
 
 KeyValuePair* V8Context::BurstPersistent(PersistentValuePtr persistent,
                                          int* out_numKeys) {
-  v8::Locker locker(mIsolate);
-  v8::Isolate::Scope isolate_scope(mIsolate);
+  Lock lock(this);
   v8::HandleScope handle_scope(mIsolate);
   v8::Context::Scope context_scope(mContext.Get(mIsolate));
   v8::Persistent<v8::Value>* persist =
@@ -351,7 +877,7 @@ KeyValuePair* V8Context::BurstPersistent(PersistentValuePtr persistent,
   KeyValuePair* result = new KeyValuePair[num_keys];
   for (int i = 0; i < num_keys; i++) {
     v8::Local<v8::Value> key = keys->Get(i);
-    result[i].keyName = strdup(str(key).c_str());
+    result[i].key = copy_string(str(key));
     result[i].value = new v8::Persistent<v8::Value>(mIsolate, object->Get(key));
   }
 
@@ -384,21 +910,903 @@ std::string ErrorReporter::report_exception(v8::TryCatch& try_catch) {
   return ss.str();
 }
 
-void V8Context::Throw(const char* errmsg) {
-  v8::Locker locker(mIsolate);
-  v8::Isolate::Scope isolate_scope(mIsolate);
+void V8Context::Throw(String errmsg) {
+  Lock lock(this);
   v8::HandleScope handle_scope(mIsolate);
   v8::Context::Scope context_scope(mContext.Get(mIsolate));
   v8::Local<v8::Value> err =
-      v8::Exception::Error(v8::String::NewFromUtf8(mIsolate, errmsg));
+      v8::Exception::Error(new_string(mIsolate, errmsg));
   mIsolate->ThrowException(err);
 }
 
-char* V8Context::Error() {
-  v8::Locker locker(mIsolate);
-  return strdup(mLastError.c_str());
+String V8Context::Error() {
+  Lock lock(this);
+  return copy_string(mLastError);
 }
 
 bool V8Context::HasTerminated() const {
   return mTerminated;
-}
\ No newline at end of file
+}
+
+void V8Context::HostCallback(const v8::FunctionCallbackInfo<v8::Value>& info) {
+  v8::Isolate* iso = info.GetIsolate();
+  v8::HandleScope scope(iso);
+  v8::Local<v8::Context> context = iso->GetCurrentContext();
+
+  v8::Local<v8::Array> data = v8::Local<v8::Array>::Cast(info.Data());
+  uint32_t ctxID =
+      data->Get(context, 0).ToLocalChecked()->Uint32Value(context).FromJust();
+  uint32_t callbackID =
+      data->Get(context, 1).ToLocalChecked()->Uint32Value(context).FromJust();
+
+  int argc = info.Length();
+  std::vector<PersistentValuePtr> argv(argc + 1);
+  for (int i = 0; i < argc; i++) {
+    argv[i] = new v8::Persistent<v8::Value>(iso, info[i]);
+  }
+  PersistentValuePtr self = new v8::Persistent<v8::Value>(iso, info.This());
+
+  bool adopted = false;
+  String errmsg = {NULL, 0};
+  PersistentValuePtr retv =
+      _go_v8_host_call(ctxID, callbackID, self, argc, &argv[0],
+                       info.IsConstructCall(), &adopted, &errmsg);
+
+  if (!adopted) {
+    argv[argc] = self;
+    for (int i = 0; i <= argc; i++) {
+      v8::Persistent<v8::Value>* arg =
+          static_cast<v8::Persistent<v8::Value>*>(argv[i]);
+      arg->Reset();
+      delete arg;
+    }
+  }
+
+  if (errmsg.ptr != NULL) {
+    throw_and_free(iso, errmsg);
+    return;
+  }
+
+  if (retv != NULL) {
+    info.GetReturnValue().Set(
+        static_cast<v8::Persistent<v8::Value>*>(retv)->Get(iso));
+  }
+}
+
+void V8Context::ReleaseGoObject(
+    const v8::WeakCallbackInfo<WeakGoObject>& info) {
+  WeakGoObject* weak = info.GetParameter();
+  weak->object.Reset();
+  weak->context->mGoObjects.erase(weak);
+  weak->release(weak->context->mId, weak->handle);
+  delete weak;
+}
+
+void V8Context::AttachGoObject(v8::Local<v8::Object> object, double handle) {
+  object->SetAlignedPointerInInternalField(0, &kGoObjectTag);
+  object->SetInternalField(1, v8::Number::New(mIsolate, handle));
+  ReleaseWhenCollected(object, handle, _go_v8_release_object);
+}
+
+void V8Context::ReleaseWhenCollected(v8::Local<v8::Object> object,
+                                     double handle,
+                                     void (*release)(unsigned int, double)) {
+  WeakGoObject* weak = new WeakGoObject(this, handle, release);
+  weak->object.Reset(mIsolate, object);
+  weak->object.SetWeak(weak, ReleaseGoObject,
+                       v8::WeakCallbackType::kParameter);
+  mGoObjects.insert(weak);
+}
+
+PersistentValuePtr V8Context::NewHostFunction(unsigned int callbackID,
+                                              String name) {
+  Lock lock(this);
+  v8::HandleScope handle_scope(mIsolate);
+  v8::Local<v8::Context> context = mContext.Get(mIsolate);
+  v8::Context::Scope context_scope(context);
+
+  // Functions created from a template are cached by the context for as long
+  // as the template lives, so one-off functions are created without one.
+  v8::Local<v8::Function> function;
+  if (!v8::Function::New(context, HostCallback, HostCallbackData(callbackID))
+           .ToLocal(&function)) {
+    return NULL;
+  }
+  function->SetName(new_string(mIsolate, name));
+  ReleaseWhenCollected(function, callbackID, _go_v8_release_host_function);
+
+  return new v8::Persistent<v8::Value>(mIsolate, function);
+}
+
+Location V8Context::Caller() {
+  Lock lock(this);
+  v8::HandleScope handle_scope(mIsolate);
+
+  Location loc = {{NULL, 0}, {NULL, 0}, 0, 0};
+  v8::Local<v8::StackTrace> trace(
+      v8::StackTrace::CurrentStackTrace(mIsolate, 1));
+  if (trace->GetFrameCount() == 1) {
+    v8::Local<v8::StackFrame> frame(trace->GetFrame(0));
+    loc.funcname = copy_string(str(frame->GetFunctionName()));
+    loc.filename = copy_string(str(frame->GetScriptName()));
+    loc.line = frame->GetLineNumber();
+    loc.column = frame->GetColumn();
+  }
+  return loc;
+}
+
+v8::Local<v8::Array> V8Context::HostCallbackData(unsigned int callbackID) {
+  v8::Local<v8::Context> context = mIsolate->GetCurrentContext();
+  v8::Local<v8::Array> data = v8::Array::New(mIsolate, 2);
+  data->Set(context, 0, v8::Integer::NewFromUnsigned(mIsolate, mId)).FromJust();
+  data->Set(context, 1, v8::Integer::NewFromUnsigned(mIsolate, callbackID))
+      .FromJust();
+  return data;
+}
+
+PersistentValuePtr V8Context::NewClass(unsigned int callbackID,
+                                       String name) {
+  Lock lock(this);
+  v8::HandleScope handle_scope(mIsolate);
+  v8::Local<v8::Context> context = mContext.Get(mIsolate);
+  v8::Context::Scope context_scope(context);
+
+  v8::Local<v8::FunctionTemplate> tmpl = v8::FunctionTemplate::New(
+      mIsolate, HostCallback, HostCallbackData(callbackID));
+  tmpl->SetClassName(new_string(mIsolate, name));
+  tmpl->InstanceTemplate()->SetInternalFieldCount(2);
+
+  v8::Local<v8::Function> function;
+  if (!tmpl->GetFunction(context).ToLocal(&function)) {
+    return NULL;
+  }
+  return new v8::Persistent<v8::Value>(mIsolate, function);
+}
+
+bool V8Context::AttachGoObject(PersistentValuePtr persistent, double handle) {
+  Lock lock(this);
+  v8::HandleScope handle_scope(mIsolate);
+  v8::Context::Scope context_scope(mContext.Get(mIsolate));
+
+  v8::Local<v8::Value> value =
+      static_cast<v8::Persistent<v8::Value>*>(persistent)->Get(mIsolate);
+  if (!value->IsObject()) {
+    return false;
+  }
+  v8::Local<v8::Object> object = v8::Local<v8::Object>::Cast(value);
+  if (object->InternalFieldCount() != 2 ||
+      object->GetInternalField(1)->IsNumber()) {
+    return false;
+  }
+  AttachGoObject(object, handle);
+  return true;
+}
+
+PersistentValuePtr V8Context::Global() {
+  Lock lock(this);
+  v8::HandleScope handle_scope(mIsolate);
+  v8::Local<v8::Context> context = mContext.Get(mIsolate);
+
+  return new v8::Persistent<v8::Value>(mIsolate, context->Global());
+}
+
+PersistentValuePtr V8Context::Get(PersistentValuePtr persistent,
+                                  String name) {
+  Lock lock(this);
+  v8::HandleScope handle_scope(mIsolate);
+  v8::Local<v8::Context> context = mContext.Get(mIsolate);
+  v8::Context::Scope context_scope(context);
+  v8::TryCatch try_catch;
+  try_catch.SetVerbose(false);
+
+  ErrorReporter er(mIsolate, &try_catch, &mLastError, &mTerminated);
+
+  v8::Local<v8::Value> maybeObject =
+      static_cast<v8::Persistent<v8::Value>*>(persistent)->Get(mIsolate);
+  if (!maybeObject->IsObject()) {
+    mLastError = "The supplied receiver is not an object.";
+    return NULL;
+  }
+
+  v8::Local<v8::Value> value;
+  if (!v8::Local<v8::Object>::Cast(maybeObject)
+           ->Get(context, new_string(mIsolate, name))
+           .ToLocal(&value)) {
+    return NULL;
+  }
+  return new v8::Persistent<v8::Value>(mIsolate, value);
+}
+
+PersistentValuePtr V8Context::Properties(PersistentValuePtr persistent,
+                                         int flags, bool values) {
+  Lock lock(this);
+  v8::HandleScope handle_scope(mIsolate);
+  v8::Local<v8::Context> context = mContext.Get(mIsolate);
+  v8::Context::Scope context_scope(context);
+  v8::TryCatch try_catch;
+  try_catch.SetVerbose(false);
+
+  ErrorReporter er(mIsolate, &try_catch, &mLastError, &mTerminated);
+
+  v8::Local<v8::Value> maybeObject =
+      static_cast<v8::Persistent<v8::Value>*>(persistent)->Get(mIsolate);
+  if (!maybeObject->IsObject()) {
+    mLastError = "The supplied receiver is not an object.";
+    return NULL;
+  }
+  v8::Local<v8::Object> object = v8::Local<v8::Object>::Cast(maybeObject);
+
+  int filter = v8::ONLY_ENUMERABLE | v8::SKIP_SYMBOLS;
+  if (flags & KEYS_SYMBOLS) {
+    filter &= ~v8::SKIP_SYMBOLS;
+  }
+  if (flags & KEYS_NON_ENUMERABLE) {
+    filter &= ~v8::ONLY_ENUMERABLE;
+  }
+  v8::Local<v8::Array> keys;
+  if (!object
+           ->GetPropertyNames(context,
+                              (flags & KEYS_INHERITED)
+                                  ? v8::KeyCollectionMode::kIncludePrototypes
+                                  : v8::KeyCollectionMode::kOwnOnly,
+                              static_cast<v8::PropertyFilter>(filter),
+                              v8::IndexFilter::kIncludeIndices,
+                              v8::KeyConversionMode::kConvertToString)
+           .ToLocal(&keys)) {
+    return NULL;
+  }
+  if (!values) {
+    return new v8::Persistent<v8::Value>(mIsolate, keys);
+  }
+
+  v8::Local<v8::Array> result = v8::Array::New(mIsolate, keys->Length() * 2);
+  for (uint32_t i = 0; i < keys->Length(); i++) {
+    v8::Local<v8::Value> key, value;
+    if (!keys->Get(context, i).ToLocal(&key) ||
+        !object->Get(context, key).ToLocal(&value) ||
+        result->Set(context, 2 * i, key).IsNothing() ||
+        result->Set(context, 2 * i + 1, value).IsNothing()) {
+      return NULL;
+    }
+  }
+  return new v8::Persistent<v8::Value>(mIsolate, result);
+}
+
+bool V8Context::Delete(PersistentValuePtr persistent, String name) {
+  Lock lock(this);
+  v8::HandleScope handle_scope(mIsolate);
+  v8::Local<v8::Context> context = mContext.Get(mIsolate);
+  v8::Context::Scope context_scope(context);
+  v8::TryCatch try_catch;
+  try_catch.SetVerbose(false);
+
+  ErrorReporter er(mIsolate, &try_catch, &mLastError, &mTerminated);
+
+  v8::Local<v8::Value> maybeObject =
+      static_cast<v8::Persistent<v8::Value>*>(persistent)->Get(mIsolate);
+  if (!maybeObject->IsObject()) {
+    mLastError = "The supplied receiver is not an object.";
+    return false;
+  }
+
+  v8::Maybe<bool> deleted = v8::Local<v8::Object>::Cast(maybeObject)
+                                ->Delete(context, new_string(mIsolate, name));
+  if (deleted.IsNothing()) {
+    return false;
+  }
+  if (!deleted.FromJust()) {
+    mLastError = "Cannot delete property '" +
+                 std::string(name.ptr ? name.ptr : "", name.len) + "'.";
+    return false;
+  }
+  return true;
+}
+
+bool V8Context::DefineProperty(PersistentValuePtr persistent, String name,
+                               const PropertyDesc* desc) {
+  Lock lock(this);
+  v8::HandleScope handle_scope(mIsolate);
+  v8::Local<v8::Context> context = mContext.Get(mIsolate);
+  v8::Context::Scope context_scope(context);
+  v8::TryCatch try_catch;
+  try_catch.SetVerbose(false);
+
+  ErrorReporter er(mIsolate, &try_catch, &mLastError, &mTerminated);
+
+  v8::Local<v8::Value> maybeObject =
+      static_cast<v8::Persistent<v8::Value>*>(persistent)->Get(mIsolate);
+  if (!maybeObject->IsObject()) {
+    mLastError = "The supplied receiver is not an object.";
+    return false;
+  }
+  v8::Local<v8::Object> object = v8::Local<v8::Object>::Cast(maybeObject);
+
+  // Empty accessors are absent from the descriptor, and keep their setting.
+  v8::Local<v8::Value> value = v8::Undefined(mIsolate);
+  v8::Local<v8::Value> get;
+  v8::Local<v8::Value> set;
+  if (desc->value != NULL) {
+    value = static_cast<v8::Persistent<v8::Value>*>(desc->value)->Get(mIsolate);
+  }
+  if (desc->get != NULL) {
+    get = static_cast<v8::Persistent<v8::Value>*>(desc->get)->Get(mIsolate);
+  }
+  if (desc->set != NULL) {
+    set = static_cast<v8::Persistent<v8::Value>*>(desc->set)->Get(mIsolate);
+  }
+
+  v8::Local<v8::String> key = new_string(mIsolate, name);
+  std::unique_ptr<v8::PropertyDescriptor> d;
+  if (desc->get != NULL || desc->set != NULL) {
+    d.reset(new v8::PropertyDescriptor(get, set));
+  } else if (desc->has_writable) {
+    // V8 has no descriptor with writable but no value, so keep the value of
+    // an existing data property.
+    if (desc->value == NULL) {
+      v8::Local<v8::Value> current;
+      if (!object->GetOwnPropertyDescriptor(context, key).ToLocal(&current)) {
+        return false;
+      }
+      if (current->IsObject()) {
+        v8::Local<v8::Object> fields = v8::Local<v8::Object>::Cast(current);
+        v8::Local<v8::String> field = v8::String::NewFromUtf8(mIsolate, "value");
+        v8::Maybe<bool> has = fields->Has(context, field);
+        if (has.IsNothing() ||
+            (has.FromJust() && !fields->Get(context, field).ToLocal(&value))) {
+          return false;
+        }
+      }
+    }
+    d.reset(new v8::PropertyDescriptor(value, desc->writable));
+  } else if (desc->value != NULL) {
+    d.reset(new v8::PropertyDescriptor(value));
+  } else {
+    d.reset(new v8::PropertyDescriptor());
+  }
+  if (desc->has_enumerable) {
+    d->set_enumerable(desc->enumerable);
+  }
+  if (desc->has_configurable) {
+    d->set_configurable(desc->configurable);
+  }
+  v8::Maybe<bool> defined = object->DefineProperty(context, key, *d);
+  if (defined.IsNothing()) {
+    return false;
+  }
+  if (!defined.FromJust()) {
+    mLastError = "Cannot redefine property: " +
+                 std::string(name.ptr ? name.ptr : "", name.len);
+    return false;
+  }
+  return true;
+}
+
+PersistentValuePtr V8Context::GetOwnPropertyDescriptor(
+    PersistentValuePtr persistent, String name) {
+  Lock lock(this);
+  v8::HandleScope handle_scope(mIsolate);
+  v8::Local<v8::Context> context = mContext.Get(mIsolate);
+  v8::Context::Scope context_scope(context);
+  v8::TryCatch try_catch;
+  try_catch.SetVerbose(false);
+
+  ErrorReporter er(mIsolate, &try_catch, &mLastError, &mTerminated);
+
+  v8::Local<v8::Value> maybeObject =
+      static_cast<v8::Persistent<v8::Value>*>(persistent)->Get(mIsolate);
+  if (!maybeObject->IsObject()) {
+    mLastError = "The supplied receiver is not an object.";
+    return NULL;
+  }
+
+  v8::Local<v8::Value> desc;
+  if (!v8::Local<v8::Object>::Cast(maybeObject)
+           ->GetOwnPropertyDescriptor(context, new_string(mIsolate, name))
+           .ToLocal(&desc)) {
+    return NULL;
+  }
+  return new v8::Persistent<v8::Value>(mIsolate, desc);
+}
+
+bool V8Context::SetIntegrity(PersistentValuePtr persistent, Integrity level) {
+  Lock lock(this);
+  v8::HandleScope handle_scope(mIsolate);
+  v8::Local<v8::Context> context = mContext.Get(mIsolate);
+  v8::Context::Scope context_scope(context);
+  v8::TryCatch try_catch;
+  try_catch.SetVerbose(false);
+
+  ErrorReporter er(mIsolate, &try_catch, &mLastError, &mTerminated);
+
+  v8::Local<v8::Value> maybeObject =
+      static_cast<v8::Persistent<v8::Value>*>(persistent)->Get(mIsolate);
+  if (!maybeObject->IsObject()) {
+    mLastError = "The supplied receiver is not an object.";
+    return false;
+  }
+  v8::Local<v8::Object> object = v8::Local<v8::Object>::Cast(maybeObject);
+
+  if (level == INTEGRITY_PREVENT_EXTENSIONS) {
+    v8::Local<v8::Value> argv[1] = {object};
+    return !mPreventExtensions.Get(mIsolate)
+                ->Call(context, v8::Undefined(mIsolate), 1, argv)
+                .IsEmpty();
+  }
+
+  v8::Maybe<bool> done = object->SetIntegrityLevel(
+      context, level == INTEGRITY_FROZEN ? v8::IntegrityLevel::kFrozen
+                                         : v8::IntegrityLevel::kSealed);
+  if (done.IsNothing()) {
+    return false;
+  }
+  if (!done.FromJust()) {
+    mLastError = level == INTEGRITY_FROZEN ? "Cannot freeze the object."
+                                           : "Cannot seal the object.";
+    return false;
+  }
+  return true;
+}
+
+bool V8Context::SetGlobalPrototype(PersistentValuePtr proto) {
+  Lock lock(this);
+  v8::HandleScope handle_scope(mIsolate);
+  v8::Local<v8::Context> context = mContext.Get(mIsolate);
+  v8::Context::Scope context_scope(context);
+  v8::TryCatch try_catch;
+  try_catch.SetVerbose(false);
+
+  ErrorReporter er(mIsolate, &try_catch, &mLastError, &mTerminated);
+
+  v8::Local<v8::Value> value =
+      static_cast<v8::Persistent<v8::Value>*>(proto)->Get(mIsolate);
+  if (!value->IsObject() && !value->IsNull()) {
+    mLastError = "The supplied prototype is not an object or null.";
+    return false;
+  }
+
+  // context->Global() is the global proxy, whose prototype is the actual
+  // global object.  The prototype of the latter is instantiated from the
+  // function template and holds the constructor property: proto goes after
+  // it.
+  v8::Local<v8::Object> global =
+      v8::Local<v8::Object>::Cast(context->Global()->GetPrototype());
+  v8::Local<v8::Object> template_proto =
+      v8::Local<v8::Object>::Cast(global->GetPrototype());
+  v8::Maybe<bool> done = template_proto->SetPrototype(context, value);
+  if (done.IsNothing()) {
+    return false;
+  }
+  if (!done.FromJust()) {
+    mLastError = "Cannot set the prototype of the global object.";
+    return false;
+  }
+  return true;
+}
+
+PersistentValuePtr V8Context::NewObject() {
+  Lock lock(this);
+  v8::HandleScope handle_scope(mIsolate);
+  v8::Context::Scope context_scope(mContext.Get(mIsolate));
+
+  return new v8::Persistent<v8::Value>(mIsolate, v8::Object::New(mIsolate));
+}
+
+PersistentValuePtr V8Context::NewGoObject(double handle,
+                                          PersistentValuePtr proto) {
+  Lock lock(this);
+  v8::HandleScope handle_scope(mIsolate);
+  v8::Local<v8::Context> context = mContext.Get(mIsolate);
+  v8::Context::Scope context_scope(context);
+
+  v8::Local<v8::Object> object;
+  if (!mGoObjectTemplate.Get(mIsolate)->NewInstance(context).ToLocal(&object)) {
+    return NULL;
+  }
+  if (proto != NULL) {
+    v8::Local<v8::Value> vproto =
+        static_cast<v8::Persistent<v8::Value>*>(proto)->Get(mIsolate);
+    if (!object->SetPrototype(context, vproto).FromMaybe(false)) {
+      return NULL;
+    }
+  }
+  AttachGoObject(object, handle);
+
+  return new v8::Persistent<v8::Value>(mIsolate, object);
+}
+
+PersistentValuePtr V8Context::NewDynamicObject(double handle) {
+  Lock lock(this);
+  v8::HandleScope handle_scope(mIsolate);
+  v8::Local<v8::Context> context = mContext.Get(mIsolate);
+  v8::Context::Scope context_scope(context);
+
+  v8::Local<v8::Object> object;
+  if (!mDynamicObjectTemplate.Get(mIsolate)->NewInstance(context).ToLocal(
+          &object)) {
+    return NULL;
+  }
+  AttachGoObject(object, handle);
+
+  return new v8::Persistent<v8::Value>(mIsolate, object);
+}
+
+double V8Context::GoObjectHandle(PersistentValuePtr persistent) {
+  Lock lock(this);
+  v8::HandleScope handle_scope(mIsolate);
+  v8::Local<v8::Context> context = mContext.Get(mIsolate);
+  v8::Context::Scope context_scope(context);
+
+  v8::Local<v8::Value> value =
+      static_cast<v8::Persistent<v8::Value>*>(persistent)->Get(mIsolate);
+  if (!value->IsObject()) {
+    return 0;
+  }
+  v8::Local<v8::Object> object = v8::Local<v8::Object>::Cast(value);
+  if (object->InternalFieldCount() != 2 ||
+      !object->GetInternalField(1)->IsNumber() ||
+      object->GetAlignedPointerFromInternalField(0) != &kGoObjectTag) {
+    return 0;
+  }
+  return object->GetInternalField(1)->NumberValue(context).FromJust();
+}
+
+const char* V8Context::DefineAccessor(PersistentValuePtr persistent,
+                                      String name,
+                                      PersistentValuePtr getter,
+                                      PersistentValuePtr setter) {
+  Lock lock(this);
+  v8::HandleScope handle_scope(mIsolate);
+  v8::Context::Scope context_scope(mContext.Get(mIsolate));
+
+  v8::Local<v8::Value> maybeObject =
+      static_cast<v8::Persistent<v8::Value>*>(persistent)->Get(mIsolate);
+  if (!maybeObject->IsObject()) {
+    return "The supplied receiver is not an object.";
+  }
+
+  v8::Local<v8::Function> get, set;
+  if (getter != NULL) {
+    v8::Local<v8::Value> vget =
+        static_cast<v8::Persistent<v8::Value>*>(getter)->Get(mIsolate);
+    if (!vget->IsFunction()) {
+      return "The supplied getter is not a function.";
+    }
+    get = v8::Local<v8::Function>::Cast(vget);
+  }
+  if (setter != NULL) {
+    v8::Local<v8::Value> vset =
+        static_cast<v8::Persistent<v8::Value>*>(setter)->Get(mIsolate);
+    if (!vset->IsFunction()) {
+      return "The supplied setter is not a function.";
+    }
+    set = v8::Local<v8::Function>::Cast(vset);
+  }
+
+  v8::Local<v8::Object>::Cast(maybeObject)
+      ->SetAccessorProperty(new_string(mIsolate, name), get, set);
+  return NULL;
+}
+
+ValueKind V8Context::Kind(PersistentValuePtr persistent) {
+  Lock lock(this);
+  v8::HandleScope handle_scope(mIsolate);
+
+  v8::Local<v8::Value> value =
+      static_cast<v8::Persistent<v8::Value>*>(persistent)->Get(mIsolate);
+  if (value->IsUndefined()) return VALUE_UNDEFINED;
+  if (value->IsNull()) return VALUE_NULL;
+  if (value->IsBoolean()) return VALUE_BOOLEAN;
+  if (value->IsNumber()) return VALUE_NUMBER;
+  if (value->IsString()) return VALUE_STRING;
+  if (value->IsSymbol()) return VALUE_SYMBOL;
+  if (value->IsFunction()) return VALUE_FUNCTION;
+  if (value->IsArray()) return VALUE_ARRAY;
+  if (value->IsDate()) return VALUE_DATE;
+  if (value->IsMap()) return VALUE_MAP;
+  if (value->IsSet()) return VALUE_SET;
+  if (value->IsRegExp()) return VALUE_REGEXP;
+#ifdef HAVE_BIGINT
+  if (value->IsBigInt()) return VALUE_BIGINT;
+#endif
+  return VALUE_OBJECT;
+}
+
+PersistentValuePtr V8Context::MapEntries(PersistentValuePtr persistent) {
+  Lock lock(this);
+  v8::HandleScope handle_scope(mIsolate);
+  v8::Context::Scope context_scope(mContext.Get(mIsolate));
+
+  v8::Local<v8::Value> value =
+      static_cast<v8::Persistent<v8::Value>*>(persistent)->Get(mIsolate);
+  if (!value->IsMap()) {
+    return NULL;
+  }
+  return new v8::Persistent<v8::Value>(
+      mIsolate, v8::Local<v8::Map>::Cast(value)->AsArray());
+}
+
+PersistentValuePtr V8Context::SetValues(PersistentValuePtr persistent) {
+  Lock lock(this);
+  v8::HandleScope handle_scope(mIsolate);
+  v8::Context::Scope context_scope(mContext.Get(mIsolate));
+
+  v8::Local<v8::Value> value =
+      static_cast<v8::Persistent<v8::Value>*>(persistent)->Get(mIsolate);
+  if (!value->IsSet()) {
+    return NULL;
+  }
+  return new v8::Persistent<v8::Value>(
+      mIsolate, v8::Local<v8::Set>::Cast(value)->AsArray());
+}
+
+bool V8Context::BigIntWords(PersistentValuePtr persistent, int* sign_bit,
+                            int* word_count, uint64_t** words) {
+#ifdef HAVE_BIGINT
+  Lock lock(this);
+  v8::HandleScope handle_scope(mIsolate);
+
+  v8::Local<v8::Value> value =
+      static_cast<v8::Persistent<v8::Value>*>(persistent)->Get(mIsolate);
+  if (!value->IsBigInt()) {
+    return false;
+  }
+  v8::Local<v8::BigInt> bigint = v8::Local<v8::BigInt>::Cast(value);
+  *word_count = bigint->WordCount();
+  *words = static_cast<uint64_t*>(malloc((*word_count + 1) * sizeof(uint64_t)));
+  bigint->ToWordsArray(sign_bit, word_count, *words);
+  return true;
+#else
+  return false;
+#endif
+}
+
+int V8Context::IdentityHash(PersistentValuePtr persistent) {
+  Lock lock(this);
+  v8::HandleScope handle_scope(mIsolate);
+
+  v8::Local<v8::Value> value =
+      static_cast<v8::Persistent<v8::Value>*>(persistent)->Get(mIsolate);
+  if (!value->IsObject()) {
+    return 0;
+  }
+  return v8::Local<v8::Object>::Cast(value)->GetIdentityHash();
+}
+
+bool V8Context::StrictEquals(PersistentValuePtr a, PersistentValuePtr b) {
+  Lock lock(this);
+  v8::HandleScope handle_scope(mIsolate);
+
+  return static_cast<v8::Persistent<v8::Value>*>(a)->Get(mIsolate)->StrictEquals(
+      static_cast<v8::Persistent<v8::Value>*>(b)->Get(mIsolate));
+}
+
+double V8Context::NumberValue(PersistentValuePtr persistent) {
+  Lock lock(this);
+  v8::HandleScope handle_scope(mIsolate);
+  v8::Local<v8::Context> context = mContext.Get(mIsolate);
+  v8::Context::Scope context_scope(context);
+
+  return static_cast<v8::Persistent<v8::Value>*>(persistent)
+      ->Get(mIsolate)
+      ->NumberValue(context)
+      .FromMaybe(0);
+}
+
+bool V8Context::BooleanValue(PersistentValuePtr persistent) {
+  Lock lock(this);
+  v8::HandleScope handle_scope(mIsolate);
+  v8::Local<v8::Context> context = mContext.Get(mIsolate);
+  v8::Context::Scope context_scope(context);
+
+  return static_cast<v8::Persistent<v8::Value>*>(persistent)
+      ->Get(mIsolate)
+      ->BooleanValue(context)
+      .FromMaybe(false);
+}
+
+String V8Context::StringValue(PersistentValuePtr persistent) {
+  Lock lock(this);
+  v8::HandleScope handle_scope(mIsolate);
+  v8::Context::Scope context_scope(mContext.Get(mIsolate));
+
+  return copy_string(
+      str(static_cast<v8::Persistent<v8::Value>*>(persistent)->Get(mIsolate)));
+}
+
+uint16_t* V8Context::StringValueUTF16(PersistentValuePtr persistent,
+                                      int* length) {
+  Lock lock(this);
+  v8::HandleScope handle_scope(mIsolate);
+  v8::Local<v8::Context> context = mContext.Get(mIsolate);
+  v8::Context::Scope context_scope(context);
+
+  v8::Local<v8::String> str;
+  if (!static_cast<v8::Persistent<v8::Value>*>(persistent)
+           ->Get(mIsolate)
+           ->ToString(context)
+           .ToLocal(&str)) {
+    *length = 0;
+    return NULL;
+  }
+  *length = str->Length();
+  uint16_t* data =
+      static_cast<uint16_t*>(malloc((*length + 1) * sizeof(uint16_t)));
+  str->Write(data, 0, *length, v8::String::NO_NULL_TERMINATION);
+  return data;
+}
+
+PersistentValuePtr V8Context::NewNumber(double num) {
+  Lock lock(this);
+  v8::HandleScope handle_scope(mIsolate);
+
+  return new v8::Persistent<v8::Value>(mIsolate,
+                                       v8::Number::New(mIsolate, num));
+}
+
+PersistentValuePtr V8Context::NewBoolean(bool b) {
+  Lock lock(this);
+  v8::HandleScope handle_scope(mIsolate);
+
+  return new v8::Persistent<v8::Value>(mIsolate,
+                                       v8::Boolean::New(mIsolate, b));
+}
+
+PersistentValuePtr V8Context::NewString(String str) {
+  Lock lock(this);
+  v8::HandleScope handle_scope(mIsolate);
+
+  return new v8::Persistent<v8::Value>(mIsolate, new_string(mIsolate, str));
+}
+
+PersistentValuePtr V8Context::NewStringUTF16(const uint16_t* data,
+                                             int length) {
+  Lock lock(this);
+  v8::HandleScope handle_scope(mIsolate);
+
+  v8::Local<v8::String> str;
+  if (!v8::String::NewFromTwoByte(mIsolate, data, v8::NewStringType::kNormal,
+                                  length)
+           .ToLocal(&str)) {
+    return NULL;
+  }
+  return new v8::Persistent<v8::Value>(mIsolate, str);
+}
+
+PersistentValuePtr V8Context::NewNull() {
+  Lock lock(this);
+  v8::HandleScope handle_scope(mIsolate);
+
+  return new v8::Persistent<v8::Value>(mIsolate, v8::Null(mIsolate));
+}
+
+PersistentValuePtr V8Context::NewUndefined() {
+  Lock lock(this);
+  v8::HandleScope handle_scope(mIsolate);
+
+  return new v8::Persistent<v8::Value>(mIsolate, v8::Undefined(mIsolate));
+}
+
+PersistentValuePtr V8Context::NewArray(int length) {
+  Lock lock(this);
+  v8::HandleScope handle_scope(mIsolate);
+  v8::Context::Scope context_scope(mContext.Get(mIsolate));
+
+  return new v8::Persistent<v8::Value>(mIsolate,
+                                       v8::Array::New(mIsolate, length));
+}
+
+PersistentValuePtr V8Context::NewMap() {
+  Lock lock(this);
+  v8::HandleScope handle_scope(mIsolate);
+  v8::Context::Scope context_scope(mContext.Get(mIsolate));
+
+  return new v8::Persistent<v8::Value>(mIsolate, v8::Map::New(mIsolate));
+}
+
+PersistentValuePtr V8Context::NewDate(double ms) {
+  Lock lock(this);
+  v8::HandleScope handle_scope(mIsolate);
+  v8::Local<v8::Context> context = mContext.Get(mIsolate);
+  v8::Context::Scope context_scope(context);
+
+  v8::Local<v8::Value> date;
+  if (!v8::Date::New(context, ms).ToLocal(&date)) {
+    return NULL;
+  }
+  return new v8::Persistent<v8::Value>(mIsolate, date);
+}
+
+PersistentValuePtr V8Context::NewUint8Array(const char* data, size_t length) {
+  Lock lock(this);
+  v8::HandleScope handle_scope(mIsolate);
+  v8::Context::Scope context_scope(mContext.Get(mIsolate));
+
+  v8::Local<v8::ArrayBuffer> buffer = v8::ArrayBuffer::New(mIsolate, length);
+  if (length > 0) {
+    memcpy(buffer->GetContents().Data(), data, length);
+  }
+  return new v8::Persistent<v8::Value>(
+      mIsolate, v8::Uint8Array::New(buffer, 0, length));
+}
+
+PersistentValuePtr V8Context::NewRegExp(String pattern, int flags) {
+  Lock lock(this);
+  v8::HandleScope handle_scope(mIsolate);
+  v8::Local<v8::Context> context = mContext.Get(mIsolate);
+  v8::Context::Scope context_scope(context);
+  v8::TryCatch try_catch;
+  try_catch.SetVerbose(false);
+
+  ErrorReporter er(mIsolate, &try_catch, &mLastError, &mTerminated);
+
+  v8::Local<v8::RegExp> regexp;
+  if (!v8::RegExp::New(context, new_string(mIsolate, pattern),
+                       static_cast<v8::RegExp::Flags>(flags))
+           .ToLocal(&regexp)) {
+    return NULL;
+  }
+  return new v8::Persistent<v8::Value>(mIsolate, regexp);
+}
+
+PersistentValuePtr V8Context::NewBigInt(int sign_bit, int word_count,
+                                        const uint64_t* words) {
+#ifdef HAVE_BIGINT
+  Lock lock(this);
+  v8::HandleScope handle_scope(mIsolate);
+  v8::Local<v8::Context> context = mContext.Get(mIsolate);
+  v8::Context::Scope context_scope(context);
+
+  v8::Local<v8::BigInt> bigint;
+  if (!v8::BigInt::NewFromWords(context, sign_bit, word_count, words)
+           .ToLocal(&bigint)) {
+    return NULL;
+  }
+  return new v8::Persistent<v8::Value>(mIsolate, bigint);
+#else
+  return NULL;
+#endif
+}
+
+const char* V8Context::SetIndex(PersistentValuePtr array, int index,
+                                PersistentValuePtr value) {
+  Lock lock(this);
+  v8::HandleScope handle_scope(mIsolate);
+  v8::Local<v8::Context> context = mContext.Get(mIsolate);
+  v8::Context::Scope context_scope(context);
+
+  v8::Local<v8::Value> maybeObject =
+      static_cast<v8::Persistent<v8::Value>*>(array)->Get(mIsolate);
+  if (!maybeObject->IsObject()) {
+    return "The supplied receiver is not an object.";
+  }
+  v8::Local<v8::Value> val =
+      static_cast<v8::Persistent<v8::Value>*>(value)->Get(mIsolate);
+  if (!v8::Local<v8::Object>::Cast(maybeObject)
+           ->Set(context, index, val)
+           .FromMaybe(false)) {
+    return "Cannot set the element.";
+  }
+  return NULL;
+}
+
+const char* V8Context::MapSet(PersistentValuePtr map, PersistentValuePtr key,
+                              PersistentValuePtr value) {
+  Lock lock(this);
+  v8::HandleScope handle_scope(mIsolate);
+  v8::Local<v8::Context> context = mContext.Get(mIsolate);
+  v8::Context::Scope context_scope(context);
+
+  v8::Local<v8::Value> maybeMap =
+      static_cast<v8::Persistent<v8::Value>*>(map)->Get(mIsolate);
+  if (!maybeMap->IsMap()) {
+    return "The supplied receiver is not a Map.";
+  }
+  v8::Local<v8::Value> k =
+      static_cast<v8::Persistent<v8::Value>*>(key)->Get(mIsolate);
+  v8::Local<v8::Value> val =
+      static_cast<v8::Persistent<v8::Value>*>(value)->Get(mIsolate);
+  if (v8::Local<v8::Map>::Cast(maybeMap)->Set(context, k, val).IsEmpty()) {
+    return "Cannot set the Map entry.";
+  }
+  return NULL;
+}
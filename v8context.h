@@ -1,42 +1,198 @@
 #ifndef V8CONTEXT_H
 #define V8CONTEXT_H
 
+#include <atomic>
+#include <set>
 #include <string>
+#include <thread>
+#include <vector>
 
 #include "v8.h"
 #include "v8wrap.h"
 
 class V8Context {
  public:
-  V8Context(v8::Isolate* isolate);
+  // id is the ID of the Go context, passed back to Go in callbacks.  opts may
+  // be NULL for the defaults.
+  V8Context(v8::Isolate* isolate, unsigned int id, const ContextOpts* opts);
   ~V8Context();
 
-  char* Execute(const char* source, const char* filename);
-  char* Error();
+  String Execute(String source, String filename);
+  String Error();
 
-  PersistentValuePtr Eval(const char* str, const char* debugFilename);
+  PersistentValuePtr Eval(String str, String debugFilename);
 
+  // Calls func as a constructor, returns NULL on failure, see Error.
+  PersistentValuePtr New(PersistentValuePtr func, int argc,
+                         PersistentValuePtr* argv);
   PersistentValuePtr Apply(PersistentValuePtr func, PersistentValuePtr self,
                            int argc, PersistentValuePtr* argv);
 
-  char* PersistentToJSON(PersistentValuePtr persistent);
+  // Returns the value as JSON, or a NULL String on failure, see Error.  opts
+  // may be NULL.
+  String ToJSON(PersistentValuePtr persistent, const JSONOptions* opts);
+  // Returns the parsed value, or NULL on failure, see Error.
+  PersistentValuePtr ParseJSON(String data);
 
   void ReleasePersistent(PersistentValuePtr persistent);
+  // Returns a new handle to the same value.
+  PersistentValuePtr CopyPersistent(PersistentValuePtr persistent);
   KeyValuePair* BurstPersistent(PersistentValuePtr persistent,
                                 int* out_numKeys);
 
   // Returns an error message on failure, otherwise returns NULL.
-  const char* SetPersistentField(PersistentValuePtr persistent,
-                                 const char* field, PersistentValuePtr value);
+  const char* SetPersistentField(PersistentValuePtr persistent, String field,
+                                 PersistentValuePtr value);
 
-  void Throw(const char* errmsg);
+  void Throw(String errmsg);
+
+  // Returns a new function that calls back into Go via _go_v8_host_call,
+  // passing it callbackID.  _go_v8_release_host_function is called once the
+  // function is collected.
+  PersistentValuePtr NewHostFunction(unsigned int callbackID, String name);
+
+  // Returns the location of the innermost script frame, e.g. the caller of a
+  // host function.  The strings must be freed by the caller.
+  Location Caller();
+
+  // Returns a new constructor that calls back into Go like a host function.
+  // Its instances have room for a Go handle, see AttachGoObject.
+  PersistentValuePtr NewClass(unsigned int callbackID, String name);
+
+  // Makes the instance of a class created by NewClass stand for the Go value
+  // with the given handle.  Returns false if persistent is not such an
+  // instance.
+  bool AttachGoObject(PersistentValuePtr persistent, double handle);
+
+  PersistentValuePtr Global();
+
+  // Returns the named property of an object, or NULL on failure, see Error.
+  PersistentValuePtr Get(PersistentValuePtr persistent, String name);
+  // Returns the keys of an object as an array, or keys and values alternately
+  // if values is set.  Returns NULL on failure, see Error.
+  PersistentValuePtr Properties(PersistentValuePtr persistent, int flags,
+                                bool values);
+  // Deletes the named property of an object, returns false on failure, see
+  // Error.
+  bool Delete(PersistentValuePtr persistent, String name);
+  // Defines the named property of an object, returns false on failure, see
+  // Error.
+  bool DefineProperty(PersistentValuePtr persistent, String name,
+                      const PropertyDesc* desc);
+  // Returns the descriptor object of the named own property of an object,
+  // undefined if there is none, or NULL on failure, see Error.
+  PersistentValuePtr GetOwnPropertyDescriptor(PersistentValuePtr persistent,
+                                              String name);
+  // Prevents extensions to an object, seals it or freezes it.  Returns false
+  // on failure, see Error.
+  bool SetIntegrity(PersistentValuePtr persistent, Integrity level);
+
+  // Sets the prototype of the global object.  Returns false on failure, see
+  // Error.
+  bool SetGlobalPrototype(PersistentValuePtr proto);
+
+  PersistentValuePtr NewObject();
+
+  ValueKind Kind(PersistentValuePtr persistent);
+
+  // Convert values of the matching kind.  StringValue and StringValueUTF16
+  // return strings that must be freed by the caller.
+  double NumberValue(PersistentValuePtr persistent);
+  bool BooleanValue(PersistentValuePtr persistent);
+  String StringValue(PersistentValuePtr persistent);
+  uint16_t* StringValueUTF16(PersistentValuePtr persistent, int* length);
+
+  PersistentValuePtr MapEntries(PersistentValuePtr persistent);
+  PersistentValuePtr SetValues(PersistentValuePtr persistent);
+  // words is allocated with malloc and must be freed by the caller.  Returns
+  // false if persistent is not a BigInt.
+  bool BigIntWords(PersistentValuePtr persistent, int* sign_bit,
+                   int* word_count, uint64_t** words);
+  int IdentityHash(PersistentValuePtr persistent);
+  bool StrictEquals(PersistentValuePtr a, PersistentValuePtr b);
+
+  PersistentValuePtr NewNumber(double num);
+  PersistentValuePtr NewBoolean(bool b);
+  PersistentValuePtr NewString(String str);
+  PersistentValuePtr NewStringUTF16(const uint16_t* data, int length);
+  PersistentValuePtr NewNull();
+  PersistentValuePtr NewUndefined();
+  PersistentValuePtr NewArray(int length);
+  PersistentValuePtr NewMap();
+  PersistentValuePtr NewDate(double ms);
+  PersistentValuePtr NewUint8Array(const char* data, size_t length);
+  // Returns NULL if the pattern is invalid, see Error.
+  PersistentValuePtr NewRegExp(String pattern, int flags);
+  // Returns NULL if BigInts are not supported.
+  PersistentValuePtr NewBigInt(int sign_bit, int word_count,
+                               const uint64_t* words);
+
+  // Return an error message on failure, otherwise return NULL.
+  const char* SetIndex(PersistentValuePtr array, int index,
+                       PersistentValuePtr value);
+  const char* MapSet(PersistentValuePtr map, PersistentValuePtr key,
+                     PersistentValuePtr value);
+
+  // Returns a new object standing for the Go value with the given handle,
+  // with proto as its prototype unless proto is NULL.  Go is told to drop the
+  // handle via _go_v8_release_object once V8 collects the object.
+  PersistentValuePtr NewGoObject(double handle, PersistentValuePtr proto);
+
+  // Returns a new object whose properties are all handled by the Go value
+  // with the given handle, through _go_v8_property.  Like NewGoObject, Go is
+  // told to drop the handle once V8 collects the object.
+  PersistentValuePtr NewDynamicObject(double handle);
+
+  // Returns the handle of an object created by NewGoObject or
+  // NewDynamicObject, otherwise 0.
+  double GoObjectHandle(PersistentValuePtr persistent);
+
+  // Defines an accessor property.  getter or setter may be NULL.  Returns an
+  // error message on failure, otherwise returns NULL.
+  const char* DefineAccessor(PersistentValuePtr persistent, String name,
+                             PersistentValuePtr getter,
+                             PersistentValuePtr setter);
 
   bool HasTerminated() const;
 
+  // Locks the isolate and enters the context until the matching Exit(), so
+  // that a sequence of operations runs without other threads interleaving.
+  // Enter/Exit pairs may be nested.  Operations made by the same thread in
+  // between reuse the lock instead of acquiring their own.
+  void Enter();
+  void Exit();
+
  private:
+  struct Scope;
+  class Lock;
+  struct WeakGoObject;
+
+  static void HostCallback(const v8::FunctionCallbackInfo<v8::Value>& info);
+  static void ReleaseGoObject(const v8::WeakCallbackInfo<WeakGoObject>& info);
+
+  // Marks object as standing for the Go value with the given handle.
+  void AttachGoObject(v8::Local<v8::Object> object, double handle);
+
+  // Calls release with the context ID and handle once V8 collects object.
+  void ReleaseWhenCollected(v8::Local<v8::Object> object, double handle,
+                            void (*release)(unsigned int, double));
+
+  // Returns the data HostCallback expects for functions calling back into Go
+  // with callbackID.  Must be called with the context entered.
+  v8::Local<v8::Array> HostCallbackData(unsigned int callbackID);
+
+  unsigned int mId;
   v8::Isolate* mIsolate;
   v8::Persistent<v8::Context> mContext;
   std::string mLastError;
+  std::vector<Scope*> mScopes;
+  // The thread that called Enter, while mScopes is not empty.
+  std::atomic<std::thread::id> mTxThread;
+  v8::Persistent<v8::ObjectTemplate> mGoObjectTemplate;
+  v8::Persistent<v8::ObjectTemplate> mDynamicObjectTemplate;
+  // Object.preventExtensions, which has no API, as of the context creation.
+  v8::Persistent<v8::Function> mPreventExtensions;
+  std::set<WeakGoObject*> mGoObjects;
 
   // If true, the last JS execution was terminated prematurely
   bool mTerminated;
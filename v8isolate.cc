@@ -27,10 +27,17 @@ V8Isolate::V8Isolate(v8::StartupData* startup_data) {
   isolate_ = v8::Isolate::New(create_params);
 }
 
-V8Context* V8Isolate::MakeContext() { return new V8Context(isolate_); }
+V8Context* V8Isolate::MakeContext(unsigned int id, const ContextOpts* opts) {
+  return new V8Context(isolate_, id, opts);
+}
 
 V8Isolate::~V8Isolate() { isolate_->Dispose(); }
 
 void V8Isolate::Terminate() { v8::V8::TerminateExecution(isolate_); }
 
+void V8Isolate::CollectGarbage() {
+  v8::Locker locker(isolate_);
+  isolate_->LowMemoryNotification();
+}
+
 v8::Unlocker* V8Isolate::Unlock() { return new v8::Unlocker(isolate_); }
\ No newline at end of file
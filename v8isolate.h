@@ -18,11 +18,15 @@ class V8Isolate {
   V8Isolate(v8::StartupData* startup_data);
   ~V8Isolate();
 
-  V8Context* MakeContext();
+  // opts may be NULL for the defaults.
+  V8Context* MakeContext(unsigned int id, const ContextOpts* opts);
 
   // May be called any any time, will forcefully terminate the VM.
   void Terminate();
 
+  // Runs a full garbage collection, including weak callbacks.
+  void CollectGarbage();
+
   // Unlocks the isolate, allowing other threads to use it. During this
   // time, the current thread may not access V8. This is intended to be
   // used for long-running callbacks, allowing the isolate to be used
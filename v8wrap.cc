@@ -37,33 +37,53 @@ extern "C" void v8_release_snapshot(SnapshotPtr snapshot) {
   delete snapshot_ptr;
 }
 
-extern "C" ContextPtr v8_create_context(IsolatePtr isolate) {
+extern "C" ContextPtr v8_create_context(IsolatePtr isolate, unsigned int id,
+                                        const ContextOpts *opts) {
   return static_cast<ContextPtr>(
-      static_cast<V8Isolate *>(isolate)->MakeContext());
+      static_cast<V8Isolate *>(isolate)->MakeContext(id, opts));
 }
 
 extern "C" void v8_release_context(ContextPtr ctx) {
   delete static_cast<V8Context *>(ctx);
 }
 
-extern "C" char *v8_execute(ContextPtr ctx, char *str, char *debugFilename) {
+extern "C" void v8_enter(ContextPtr ctx) {
+  (static_cast<V8Context *>(ctx))->Enter();
+}
+
+extern "C" void v8_exit(ContextPtr ctx) {
+  (static_cast<V8Context *>(ctx))->Exit();
+}
+
+extern "C" String v8_execute(ContextPtr ctx, String str,
+                             String debugFilename) {
   return (static_cast<V8Context *>(ctx))->Execute(str, debugFilename);
 }
 
-extern "C" PersistentValuePtr v8_eval(ContextPtr ctx, char *str,
-                                      char *debugFilename) {
+extern "C" PersistentValuePtr v8_eval(ContextPtr ctx, String str,
+                                      String debugFilename) {
   return (static_cast<V8Context *>(ctx))->Eval(str, debugFilename);
 }
 
+extern "C" PersistentValuePtr v8_new_instance(ContextPtr ctx,
+                                              PersistentValuePtr func, int argc,
+                                              PersistentValuePtr *argv) {
+  return (static_cast<V8Context *>(ctx))->New(func, argc, argv);
+}
+
 extern "C" PersistentValuePtr v8_apply(ContextPtr ctx, PersistentValuePtr func,
                                        PersistentValuePtr self, int argc,
                                        PersistentValuePtr *argv) {
   return (static_cast<V8Context *>(ctx))->Apply(func, self, argc, argv);
 }
 
-extern "C" char *PersistentToJSON(ContextPtr ctx,
-                                  PersistentValuePtr persistent) {
-  return (static_cast<V8Context *>(ctx))->PersistentToJSON(persistent);
+extern "C" String v8_to_json(ContextPtr ctx, PersistentValuePtr persistent,
+                             const JSONOptions *opts) {
+  return (static_cast<V8Context *>(ctx))->ToJSON(persistent, opts);
+}
+
+extern "C" PersistentValuePtr v8_parse_json(ContextPtr ctx, String data) {
+  return (static_cast<V8Context *>(ctx))->ParseJSON(data);
 }
 
 extern "C" void *v8_BurstPersistent(ContextPtr ctx,
@@ -75,7 +95,7 @@ extern "C" void *v8_BurstPersistent(ContextPtr ctx,
 
 extern "C" const char *v8_setPersistentField(ContextPtr ctx,
                                              PersistentValuePtr persistent,
-                                             const char *field,
+                                             String field,
                                              PersistentValuePtr value) {
   return ((static_cast<V8Context *>(ctx))
               ->SetPersistentField(persistent, field, value));
@@ -86,7 +106,12 @@ extern "C" void v8_release_persistent(ContextPtr ctx,
   (static_cast<V8Context *>(ctx))->ReleasePersistent(persistent);
 }
 
-extern "C" char *v8_error(ContextPtr ctx) {
+extern "C" PersistentValuePtr v8_copy_persistent(
+    ContextPtr ctx, PersistentValuePtr persistent) {
+  return (static_cast<V8Context *>(ctx))->CopyPersistent(persistent);
+}
+
+extern "C" String v8_error(ContextPtr ctx) {
   return (static_cast<V8Context *>(ctx))->Error();
 }
 
@@ -94,14 +119,230 @@ extern "C" bool v8_context_has_terminated(ContextPtr ctx) {
   return (static_cast<V8Context *>(ctx))->HasTerminated();
 }
 
-extern "C" void v8_throw(ContextPtr ctx, char *errmsg) {
+extern "C" void v8_throw(ContextPtr ctx, String errmsg) {
   return (static_cast<V8Context *>(ctx))->Throw(errmsg);
 }
 
+extern "C" PersistentValuePtr v8_new_host_function(ContextPtr ctx,
+                                                   unsigned int callbackID,
+                                                   String name) {
+  return (static_cast<V8Context *>(ctx))->NewHostFunction(callbackID, name);
+}
+
+extern "C" Location v8_caller(ContextPtr ctx) {
+  return (static_cast<V8Context *>(ctx))->Caller();
+}
+
+extern "C" PersistentValuePtr v8_new_class(ContextPtr ctx,
+                                           unsigned int callbackID,
+                                           String name) {
+  return (static_cast<V8Context *>(ctx))->NewClass(callbackID, name);
+}
+
+extern "C" bool v8_attach_go_object(ContextPtr ctx,
+                                    PersistentValuePtr persistent,
+                                    double handle) {
+  return (static_cast<V8Context *>(ctx))->AttachGoObject(persistent, handle);
+}
+
+extern "C" PersistentValuePtr v8_global(ContextPtr ctx) {
+  return (static_cast<V8Context *>(ctx))->Global();
+}
+
+extern "C" PersistentValuePtr v8_get(ContextPtr ctx,
+                                     PersistentValuePtr persistent,
+                                     String name) {
+  return (static_cast<V8Context *>(ctx))->Get(persistent, name);
+}
+
+extern "C" PersistentValuePtr v8_properties(ContextPtr ctx,
+                                            PersistentValuePtr persistent,
+                                            int flags, bool values) {
+  return (static_cast<V8Context *>(ctx))->Properties(persistent, flags, values);
+}
+
+extern "C" bool v8_delete(ContextPtr ctx, PersistentValuePtr persistent,
+                          String name) {
+  return (static_cast<V8Context *>(ctx))->Delete(persistent, name);
+}
+
+extern "C" bool v8_define_property(ContextPtr ctx,
+                                   PersistentValuePtr persistent, String name,
+                                   const PropertyDesc *desc) {
+  return (static_cast<V8Context *>(ctx))->DefineProperty(persistent, name, desc);
+}
+
+extern "C" PersistentValuePtr v8_get_own_property_descriptor(
+    ContextPtr ctx, PersistentValuePtr persistent, String name) {
+  return (static_cast<V8Context *>(ctx))
+      ->GetOwnPropertyDescriptor(persistent, name);
+}
+
+extern "C" bool v8_set_integrity(ContextPtr ctx, PersistentValuePtr persistent,
+                                 Integrity level) {
+  return (static_cast<V8Context *>(ctx))->SetIntegrity(persistent, level);
+}
+
+extern "C" bool v8_set_global_prototype(ContextPtr ctx,
+                                        PersistentValuePtr proto) {
+  return (static_cast<V8Context *>(ctx))->SetGlobalPrototype(proto);
+}
+
+extern "C" PersistentValuePtr v8_new_object(ContextPtr ctx) {
+  return (static_cast<V8Context *>(ctx))->NewObject();
+}
+
+extern "C" ValueKind v8_value_kind(ContextPtr ctx,
+                                   PersistentValuePtr persistent) {
+  return (static_cast<V8Context *>(ctx))->Kind(persistent);
+}
+
+extern "C" double v8_value_number(ContextPtr ctx,
+                                  PersistentValuePtr persistent) {
+  return (static_cast<V8Context *>(ctx))->NumberValue(persistent);
+}
+
+extern "C" bool v8_value_bool(ContextPtr ctx, PersistentValuePtr persistent) {
+  return (static_cast<V8Context *>(ctx))->BooleanValue(persistent);
+}
+
+extern "C" String v8_value_string(ContextPtr ctx,
+                                  PersistentValuePtr persistent) {
+  return (static_cast<V8Context *>(ctx))->StringValue(persistent);
+}
+
+extern "C" uint16_t *v8_value_utf16(ContextPtr ctx,
+                                    PersistentValuePtr persistent,
+                                    int *length) {
+  return (static_cast<V8Context *>(ctx))->StringValueUTF16(persistent, length);
+}
+
+extern "C" PersistentValuePtr v8_map_entries(ContextPtr ctx,
+                                             PersistentValuePtr persistent) {
+  return (static_cast<V8Context *>(ctx))->MapEntries(persistent);
+}
+
+extern "C" PersistentValuePtr v8_set_values(ContextPtr ctx,
+                                            PersistentValuePtr persistent) {
+  return (static_cast<V8Context *>(ctx))->SetValues(persistent);
+}
+
+extern "C" bool v8_bigint_words(ContextPtr ctx, PersistentValuePtr persistent,
+                                int *sign_bit, int *word_count,
+                                uint64_t **words) {
+  return (static_cast<V8Context *>(ctx))
+      ->BigIntWords(persistent, sign_bit, word_count, words);
+}
+
+extern "C" int v8_identity_hash(ContextPtr ctx,
+                                PersistentValuePtr persistent) {
+  return (static_cast<V8Context *>(ctx))->IdentityHash(persistent);
+}
+
+extern "C" bool v8_strict_equals(ContextPtr ctx, PersistentValuePtr a,
+                                 PersistentValuePtr b) {
+  return (static_cast<V8Context *>(ctx))->StrictEquals(a, b);
+}
+
+extern "C" PersistentValuePtr v8_new_number(ContextPtr ctx, double num) {
+  return (static_cast<V8Context *>(ctx))->NewNumber(num);
+}
+
+extern "C" PersistentValuePtr v8_new_bool(ContextPtr ctx, bool b) {
+  return (static_cast<V8Context *>(ctx))->NewBoolean(b);
+}
+
+extern "C" PersistentValuePtr v8_new_string(ContextPtr ctx, String str) {
+  return (static_cast<V8Context *>(ctx))->NewString(str);
+}
+
+extern "C" PersistentValuePtr v8_new_string_utf16(ContextPtr ctx,
+                                                  const uint16_t *data,
+                                                  int length) {
+  return (static_cast<V8Context *>(ctx))->NewStringUTF16(data, length);
+}
+
+extern "C" PersistentValuePtr v8_new_null(ContextPtr ctx) {
+  return (static_cast<V8Context *>(ctx))->NewNull();
+}
+
+extern "C" PersistentValuePtr v8_new_undefined(ContextPtr ctx) {
+  return (static_cast<V8Context *>(ctx))->NewUndefined();
+}
+
+extern "C" PersistentValuePtr v8_new_array(ContextPtr ctx, int length) {
+  return (static_cast<V8Context *>(ctx))->NewArray(length);
+}
+
+extern "C" PersistentValuePtr v8_new_map(ContextPtr ctx) {
+  return (static_cast<V8Context *>(ctx))->NewMap();
+}
+
+extern "C" PersistentValuePtr v8_new_date(ContextPtr ctx, double ms) {
+  return (static_cast<V8Context *>(ctx))->NewDate(ms);
+}
+
+extern "C" PersistentValuePtr v8_new_uint8array(ContextPtr ctx,
+                                                const char *data,
+                                                size_t length) {
+  return (static_cast<V8Context *>(ctx))->NewUint8Array(data, length);
+}
+
+extern "C" PersistentValuePtr v8_new_regexp(ContextPtr ctx,
+                                            String pattern, int flags) {
+  return (static_cast<V8Context *>(ctx))->NewRegExp(pattern, flags);
+}
+
+extern "C" PersistentValuePtr v8_new_bigint(ContextPtr ctx, int sign_bit,
+                                            int word_count,
+                                            const uint64_t *words) {
+  return (static_cast<V8Context *>(ctx))
+      ->NewBigInt(sign_bit, word_count, words);
+}
+
+extern "C" const char *v8_set_index(ContextPtr ctx, PersistentValuePtr array,
+                                    int index, PersistentValuePtr value) {
+  return (static_cast<V8Context *>(ctx))->SetIndex(array, index, value);
+}
+
+extern "C" const char *v8_map_set(ContextPtr ctx, PersistentValuePtr map,
+                                  PersistentValuePtr key,
+                                  PersistentValuePtr value) {
+  return (static_cast<V8Context *>(ctx))->MapSet(map, key, value);
+}
+
+extern "C" PersistentValuePtr v8_new_go_object(ContextPtr ctx, double handle,
+                                               PersistentValuePtr proto) {
+  return (static_cast<V8Context *>(ctx))->NewGoObject(handle, proto);
+}
+
+extern "C" PersistentValuePtr v8_new_dynamic_object(ContextPtr ctx,
+                                                    double handle) {
+  return (static_cast<V8Context *>(ctx))->NewDynamicObject(handle);
+}
+
+extern "C" double v8_go_object_handle(ContextPtr ctx,
+                                      PersistentValuePtr persistent) {
+  return (static_cast<V8Context *>(ctx))->GoObjectHandle(persistent);
+}
+
+extern "C" const char *v8_define_accessor(ContextPtr ctx,
+                                          PersistentValuePtr persistent,
+                                          String name,
+                                          PersistentValuePtr getter,
+                                          PersistentValuePtr setter) {
+  return (static_cast<V8Context *>(ctx))
+      ->DefineAccessor(persistent, name, getter, setter);
+}
+
 extern "C" void v8_terminate(IsolatePtr isolate) {
   (static_cast<V8Isolate *>(isolate))->Terminate();
 }
 
+extern "C" void v8_collect_garbage(IsolatePtr isolate) {
+  (static_cast<V8Isolate *>(isolate))->CollectGarbage();
+}
+
 extern UnlockerPtr v8_create_unlocker(IsolatePtr isolate) {
   return static_cast<UnlockerPtr>(
       static_cast<V8Isolate *>(isolate)->Unlock());
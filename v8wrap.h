@@ -2,6 +2,8 @@
 #define V8WRAP_H
 
 #include <stdbool.h>
+#include <stddef.h>
+#include <stdint.h>
 
 #ifdef __cplusplus
 extern "C" {
@@ -14,6 +16,32 @@ typedef void *PlatformPtr;
 typedef void *SnapshotPtr;
 typedef void *UnlockerPtr;
 
+// A UTF-8 string with an explicit length, so that it may contain NUL bytes.
+// Strings returned by the functions below are allocated with malloc and must
+// be freed by the caller; a NULL ptr stands for no string.
+typedef struct {
+  char *ptr;
+  int len;
+} String;
+
+// The kinds of JS values told apart by v8_value_kind.
+typedef enum {
+  VALUE_UNDEFINED,
+  VALUE_NULL,
+  VALUE_BOOLEAN,
+  VALUE_NUMBER,
+  VALUE_STRING,
+  VALUE_SYMBOL,
+  VALUE_FUNCTION,
+  VALUE_ARRAY,
+  VALUE_DATE,
+  VALUE_MAP,
+  VALUE_SET,
+  VALUE_BIGINT,
+  VALUE_REGEXP,
+  VALUE_OBJECT,
+} ValueKind;
+
 extern PlatformPtr v8_init();
 
 extern IsolatePtr v8_create_isolate();
@@ -26,23 +54,69 @@ extern SnapshotPtr v8_create_snapshot(const char *snapshot_js);
 
 extern void v8_release_snapshot(SnapshotPtr snapshot);
 
-extern ContextPtr v8_create_context(IsolatePtr isolate);
+// Options for v8_create_context.
+typedef struct {
+  // Resolves the identifiers that are defined nowhere else through
+  // _go_v8_resolve_global, with an interceptor on the global object.
+  bool global_resolver;
+  // The class name of the global object, unless empty.
+  String global_name;
+  // Makes eval and new Function throw an EvalError.
+  bool disallow_code_generation;
+} ContextOpts;
+
+// opts may be NULL for the defaults.
+extern ContextPtr v8_create_context(IsolatePtr isolate, unsigned int id,
+                                    const ContextOpts *opts);
 
 extern void v8_release_context(ContextPtr ctx);
 
-extern char *v8_execute(ContextPtr ctx, char *str, char *debugFilename);
+extern void v8_enter(ContextPtr ctx);
+
+extern void v8_exit(ContextPtr ctx);
+
+// A NULL debugFilename.ptr stands for "undefined".
+extern String v8_execute(ContextPtr ctx, String str, String debugFilename);
+
+extern PersistentValuePtr v8_eval(ContextPtr ctx, String str,
+                                  String debugFilename);
 
-extern PersistentValuePtr v8_eval(ContextPtr ctx, char *str,
-                                  char *debugFilename);
+// Calls func as a constructor, like the new operator.  Returns NULL on
+// failure; the error can be retrieved with v8_error.
+extern PersistentValuePtr v8_new_instance(ContextPtr ctx,
+                                          PersistentValuePtr func, int argc,
+                                          PersistentValuePtr *argv);
 
 extern PersistentValuePtr v8_apply(ContextPtr ctx, PersistentValuePtr func,
                                    PersistentValuePtr self, int argc,
                                    PersistentValuePtr *argv);
 
-extern char *PersistentToJSON(ContextPtr ctx, PersistentValuePtr persistent);
+// How v8_to_json converts values, beyond what JSON.stringify does.
+typedef struct {
+  // Indents nested values, unless empty.
+  String indent;
+  // The only object fields to keep, unless fields_len is negative.
+  String *fields;
+  int fields_len;
+  // Replaces references to an object from within itself by
+  // cycle_placeholder, instead of failing.
+  bool break_cycles;
+  String cycle_placeholder;
+  // Converts BigInts to strings of decimal digits, instead of failing.
+  bool bigint_as_string;
+} JSONOptions;
+
+// Returns the value as JSON, or a NULL String on failure; the error can be
+// retrieved with v8_error.  opts may be NULL.
+extern String v8_to_json(ContextPtr ctx, PersistentValuePtr persistent,
+                         const JSONOptions *opts);
+
+// Returns the parsed value, or NULL on failure; the error can be retrieved
+// with v8_error.
+extern PersistentValuePtr v8_parse_json(ContextPtr ctx, String data);
 
 struct KeyValuePair {
-  char *keyName;
+  String key;
   PersistentValuePtr value;
 };
 
@@ -57,20 +131,215 @@ extern void *v8_BurstPersistent(ContextPtr ctx, PersistentValuePtr persistent,
 // should NOT be freed by the caller.
 extern const char *v8_setPersistentField(ContextPtr ctx,
                                          PersistentValuePtr persistent,
-                                         const char *field,
+                                         String field,
                                          PersistentValuePtr value);
 
 extern void v8_release_persistent(ContextPtr ctx,
                                   PersistentValuePtr persistent);
 
-extern char *v8_error(ContextPtr ctx);
+// Returns a new handle to the same value.
+extern PersistentValuePtr v8_copy_persistent(ContextPtr ctx,
+                                             PersistentValuePtr persistent);
+
+extern String v8_error(ContextPtr ctx);
 
 extern bool v8_context_has_terminated(ContextPtr ctx);
 
-extern void v8_throw(ContextPtr ctx, char *errmsg);
+extern void v8_throw(ContextPtr ctx, String errmsg);
+
+extern PersistentValuePtr v8_new_host_function(ContextPtr ctx,
+                                               unsigned int callbackID,
+                                               String name);
+
+// A script location, see v8_caller.
+typedef struct {
+  String funcname;
+  String filename;
+  int line;
+  int column;
+} Location;
+
+// Returns the location of the innermost script frame, e.g. the caller of a
+// host function, or an empty location outside scripts.  The strings must be
+// freed by the caller.
+extern Location v8_caller(ContextPtr ctx);
+
+extern PersistentValuePtr v8_new_class(ContextPtr ctx, unsigned int callbackID,
+                                       String name);
+
+extern bool v8_attach_go_object(ContextPtr ctx, PersistentValuePtr persistent,
+                                double handle);
+
+extern PersistentValuePtr v8_global(ContextPtr ctx);
+
+// Returns the named property of an object, or NULL on failure; the error can
+// be retrieved with v8_error.
+extern PersistentValuePtr v8_get(ContextPtr ctx, PersistentValuePtr persistent,
+                                 String name);
+
+// Which properties v8_properties returns, besides the object's own
+// enumerable string-keyed ones.
+typedef enum {
+  KEYS_INHERITED = 1 << 0,
+  KEYS_SYMBOLS = 1 << 1,
+  KEYS_NON_ENUMERABLE = 1 << 2,
+} KeysFlags;
+
+// Returns the keys of an object as an array, in property order, or keys and
+// values alternately if values is set.  Returns NULL on failure; the error
+// can be retrieved with v8_error.
+extern PersistentValuePtr v8_properties(ContextPtr ctx,
+                                        PersistentValuePtr persistent,
+                                        int flags, bool values);
+
+// Deletes the named property of an object, returns false on failure; the
+// error can be retrieved with v8_error.
+extern bool v8_delete(ContextPtr ctx, PersistentValuePtr persistent,
+                      String name);
+
+// A property descriptor for v8_define_property.  Only the fields that are set
+// change: value, get and set are set unless NULL, and the attributes are set
+// when their has_ flag is.
+typedef struct {
+  PersistentValuePtr value;
+  PersistentValuePtr get;
+  PersistentValuePtr set;
+  bool has_writable;
+  bool writable;
+  bool has_enumerable;
+  bool enumerable;
+  bool has_configurable;
+  bool configurable;
+} PropertyDesc;
+
+// Defines the named property of an object, returns false on failure; the
+// error can be retrieved with v8_error.
+extern bool v8_define_property(ContextPtr ctx, PersistentValuePtr persistent,
+                               String name, const PropertyDesc *desc);
+
+// Returns the descriptor object of the named own property of an object, or
+// undefined if there is none.  Returns NULL on failure; the error can be
+// retrieved with v8_error.
+extern PersistentValuePtr v8_get_own_property_descriptor(
+    ContextPtr ctx, PersistentValuePtr persistent, String name);
+
+typedef enum {
+  INTEGRITY_PREVENT_EXTENSIONS,
+  INTEGRITY_SEALED,
+  INTEGRITY_FROZEN,
+} Integrity;
+
+// Prevents extensions to an object, seals it or freezes it, like the Object
+// functions of the same names.  Returns false on failure; the error can be
+// retrieved with v8_error.
+extern bool v8_set_integrity(ContextPtr ctx, PersistentValuePtr persistent,
+                             Integrity level);
+
+// Sets the prototype of the global object to proto, an object or null, so
+// that its properties can be read as globals.  Returns false on failure; the
+// error can be retrieved with v8_error.
+extern bool v8_set_global_prototype(ContextPtr ctx, PersistentValuePtr proto);
+
+extern PersistentValuePtr v8_new_object(ContextPtr ctx);
+
+extern ValueKind v8_value_kind(ContextPtr ctx, PersistentValuePtr persistent);
+
+// The following convert values of the matching kind.  The UTF-16 code units
+// returned by v8_value_utf16 must be freed by the caller.
+extern double v8_value_number(ContextPtr ctx, PersistentValuePtr persistent);
+extern bool v8_value_bool(ContextPtr ctx, PersistentValuePtr persistent);
+extern String v8_value_string(ContextPtr ctx, PersistentValuePtr persistent);
+extern uint16_t *v8_value_utf16(ContextPtr ctx, PersistentValuePtr persistent,
+                                int *length);
+
+// Returns the entries of a Map as a flat [key, value, key, value, ...] array.
+extern PersistentValuePtr v8_map_entries(ContextPtr ctx,
+                                         PersistentValuePtr persistent);
+
+// Returns the values of a Set as an array.
+extern PersistentValuePtr v8_set_values(ContextPtr ctx,
+                                        PersistentValuePtr persistent);
+
+// Stores the sign and magnitude of a BigInt, least significant word first.
+// *words is allocated with malloc and must be freed by the caller.  Returns
+// false if the value is not a BigInt.
+extern bool v8_bigint_words(ContextPtr ctx, PersistentValuePtr persistent,
+                            int *sign_bit, int *word_count, uint64_t **words);
+
+// Returns the identity hash of an object, or 0 for other values.
+extern int v8_identity_hash(ContextPtr ctx, PersistentValuePtr persistent);
+
+extern bool v8_strict_equals(ContextPtr ctx, PersistentValuePtr a,
+                             PersistentValuePtr b);
+
+extern PersistentValuePtr v8_new_number(ContextPtr ctx, double num);
+extern PersistentValuePtr v8_new_bool(ContextPtr ctx, bool b);
+extern PersistentValuePtr v8_new_string(ContextPtr ctx, String str);
+extern PersistentValuePtr v8_new_string_utf16(ContextPtr ctx,
+                                              const uint16_t *data,
+                                              int length);
+extern PersistentValuePtr v8_new_null(ContextPtr ctx);
+extern PersistentValuePtr v8_new_undefined(ContextPtr ctx);
+extern PersistentValuePtr v8_new_array(ContextPtr ctx, int length);
+extern PersistentValuePtr v8_new_map(ContextPtr ctx);
+extern PersistentValuePtr v8_new_date(ContextPtr ctx, double ms);
+extern PersistentValuePtr v8_new_uint8array(ContextPtr ctx, const char *data,
+                                            size_t length);
+
+// Returns NULL if the V8 version has no BigInt support.  words holds the
+// magnitude, least significant word first.
+extern PersistentValuePtr v8_new_bigint(ContextPtr ctx, int sign_bit,
+                                        int word_count, const uint64_t *words);
+
+// flags is a combination of the V8 RegExp flags.  Returns NULL if the pattern
+// is invalid; the error can be retrieved with v8_error.
+extern PersistentValuePtr v8_new_regexp(ContextPtr ctx, String pattern,
+                                        int flags);
+
+// Return a constant error string on errors, otherwise a NULL.  The error msg
+// should NOT be freed by the caller.
+extern const char *v8_set_index(ContextPtr ctx, PersistentValuePtr array,
+                                int index, PersistentValuePtr value);
+extern const char *v8_map_set(ContextPtr ctx, PersistentValuePtr map,
+                              PersistentValuePtr key,
+                              PersistentValuePtr value);
+
+extern PersistentValuePtr v8_new_go_object(ContextPtr ctx, double handle,
+                                           PersistentValuePtr proto);
+
+// The operations of the interceptors of dynamic objects, passed to
+// _go_v8_property.
+typedef enum {
+  PROPERTY_GET,
+  PROPERTY_SET,
+  PROPERTY_QUERY,
+  PROPERTY_DELETE,
+  // The names of the properties that are not array indices.
+  PROPERTY_KEYS,
+  // The array indices among the names of the properties.
+  PROPERTY_INDEX_KEYS,
+} PropertyOp;
+
+// Returns a new object whose properties are all handled by the Go value with
+// the given handle.  Like for v8_new_go_object, Go drops the handle once V8
+// collects the object.
+extern PersistentValuePtr v8_new_dynamic_object(ContextPtr ctx, double handle);
+
+extern double v8_go_object_handle(ContextPtr ctx,
+                                  PersistentValuePtr persistent);
+
+// Returns a constant error string on errors, otherwise a NULL.  The error msg
+// should NOT be freed by the caller.
+extern const char *v8_define_accessor(ContextPtr ctx,
+                                      PersistentValuePtr persistent,
+                                      String name,
+                                      PersistentValuePtr getter,
+                                      PersistentValuePtr setter);
 
 extern void v8_terminate(IsolatePtr iso);
 
+extern void v8_collect_garbage(IsolatePtr iso);
+
 extern UnlockerPtr v8_create_unlocker(IsolatePtr isolate);
 
 extern void v8_release_unlocker(UnlockerPtr unlocker);
@@ -0,0 +1,297 @@
+package v8
+
+// #include "v8wrap.h"
+import "C"
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+var jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// Wrap returns a JS object backed by obj, which must be a non-nil pointer to
+// a struct.  Instead of copying obj like ToValue does, the object reads and
+// writes obj itself, so changes made on either side are visible on the other:
+//
+//   - Exported fields are getter/setter properties.  Reading one converts its
+//     current value to JS, assigning one converts the JS value back.
+//   - Exported methods of the pointer type are functions.  Their arguments are
+//     converted to the parameter types; a trailing error result is thrown.
+//     Methods with several other results return them as an array.
+//
+// Struct fields and pointers to structs are wrapped in turn rather than
+// copied, unless they implement json.Marshaler.  Each access returns a new
+// wrapper, so two wrappers of the same Go value are not === in JS.
+//
+// Field names come from the "js" struct tag, then the "json" tag, then the Go
+// name.  Fields tagged "-" are hidden.
+func (v *V8Context) Wrap(obj interface{}) (*Value, error) {
+	rv := reflect.ValueOf(obj)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("Cannot wrap %T: expected a non-nil pointer to a struct", obj)
+	}
+
+	var res *Value
+	var err error
+	v.exec(func() {
+		if v.v8context == nil {
+			err = ErrContextDestroyed
+			return
+		}
+		res, err = v.wrap(rv)
+	})
+	return res, err
+}
+
+func (v *V8Context) wrap(rv reflect.Value) (*Value, error) {
+	proto, err := v.wrapPrototype(rv.Type())
+	if err != nil {
+		return nil, err
+	}
+	return v.newGoObject(rv.Interface(), proto)
+}
+
+// wrapPrototype returns the prototype shared by the wrappers of values of
+// type t, creating it the first time.
+func (v *V8Context) wrapPrototype(t reflect.Type) (C.PersistentValuePtr, error) {
+	if proto, ok := v.wrapProtos[t]; ok {
+		return proto, nil
+	}
+
+	proto := C.v8_new_object(v.v8context)
+	var funcs []*Value
+	defer func() { v.releaseValues(funcs...) }()
+
+	for _, field := range wrapFields(t.Elem()) {
+		getter, err := v.newHostFunction("get "+field.name, v.fieldGetter(t, field.index))
+		if err != nil {
+			C.v8_release_persistent(v.v8context, proto)
+			return nil, err
+		}
+		setter, err := v.newHostFunction("set "+field.name, v.fieldSetter(t, field.index))
+		if err != nil {
+			C.v8_release_persistent(v.v8context, proto)
+			return nil, err
+		}
+		funcs = append(funcs, getter, setter)
+
+		name := newCString(field.name)
+		errmsg := C.v8_define_accessor(v.v8context, proto, name, getter.ptr, setter.ptr)
+		freeCString(name)
+		if errmsg != nil {
+			C.v8_release_persistent(v.v8context, proto)
+			return nil, errors.New(C.GoString(errmsg))
+		}
+	}
+
+	for i := 0; i < t.NumMethod(); i++ {
+		method := t.Method(i)
+		fn, err := v.newHostFunction(method.Name, v.methodCaller(t, method))
+		if err != nil {
+			C.v8_release_persistent(v.v8context, proto)
+			return nil, err
+		}
+		funcs = append(funcs, fn)
+
+		name := newCString(method.Name)
+		errmsg := C.v8_setPersistentField(v.v8context, proto, name, fn.ptr)
+		freeCString(name)
+		if errmsg != nil {
+			C.v8_release_persistent(v.v8context, proto)
+			return nil, errors.New(C.GoString(errmsg))
+		}
+	}
+
+	v.wrapProtos[t] = proto
+	return proto, nil
+}
+
+type wrapField struct {
+	name  string
+	index []int
+}
+
+// wrapFields lists the exported fields of the struct type t, including those
+// promoted from embedded structs that aren't shadowed.
+func wrapFields(t reflect.Type) []wrapField {
+	var fields []wrapField
+	var embedded []wrapField
+	seen := map[string]bool{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Anonymous && f.Type.Kind() == reflect.Struct && f.Tag.Get("js") == "" {
+			embedded = append(embedded, wrapField{f.Name, f.Index})
+			continue
+		}
+		name, ok := jsFieldName(f)
+		if !ok {
+			continue
+		}
+		seen[name] = true
+		fields = append(fields, wrapField{name, f.Index})
+	}
+	for _, e := range embedded {
+		for _, f := range wrapFields(t.FieldByIndex(e.index).Type) {
+			if seen[f.name] {
+				continue
+			}
+			seen[f.name] = true
+			fields = append(fields, wrapField{f.name, append(append([]int{}, e.index...), f.index...)})
+		}
+	}
+	return fields
+}
+
+// jsFieldName returns the name a struct field has in JS, and whether the
+// field is visible from JS at all.
+func jsFieldName(f reflect.StructField) (string, bool) {
+	if f.PkgPath != "" {
+		return "", false
+	}
+	for _, key := range []string{"js", "json"} {
+		tag := f.Tag.Get(key)
+		if tag == "-" {
+			return "", false
+		}
+		if name := strings.Split(tag, ",")[0]; name != "" {
+			return name, true
+		}
+	}
+	return f.Name, true
+}
+
+// receiver returns the Go value behind the wrapper this, which must be of
+// type t.
+func (v *V8Context) receiver(this *Value, t reflect.Type) (reflect.Value, error) {
+	if obj, ok := v.goObject(this); ok && reflect.TypeOf(obj) == t {
+		return reflect.ValueOf(obj), nil
+	}
+	return reflect.Value{}, fmt.Errorf("Illegal invocation: receiver is not a wrapped %v", t)
+}
+
+func (v *V8Context) fieldGetter(t reflect.Type, index []int) hostFunc {
+	return func(this *Value, args []*Value, construct bool) (*Value, error) {
+		defer v.releaseValues(append(args, this)...)
+		rv, err := v.receiver(this, t)
+		if err != nil {
+			return nil, err
+		}
+		res, err := v.wrapResult(rv.Elem().FieldByIndex(index))
+		if err != nil {
+			return nil, err
+		}
+		return v.releaseLater(res), nil
+	}
+}
+
+func (v *V8Context) fieldSetter(t reflect.Type, index []int) hostFunc {
+	return func(this *Value, args []*Value, construct bool) (*Value, error) {
+		defer v.releaseValues(append(args, this)...)
+		rv, err := v.receiver(this, t)
+		if err != nil {
+			return nil, err
+		}
+		if len(args) == 0 {
+			return nil, nil
+		}
+		field := rv.Elem().FieldByIndex(index)
+		val, err := v.wrapArg(args[0], field.Type())
+		if err != nil {
+			return nil, err
+		}
+		field.Set(val)
+		return nil, nil
+	}
+}
+
+func (v *V8Context) methodCaller(t reflect.Type, method reflect.Method) hostFunc {
+	mt := method.Type
+	return func(this *Value, args []*Value, construct bool) (*Value, error) {
+		defer v.releaseValues(append(args, this)...)
+		rv, err := v.receiver(this, t)
+		if err != nil {
+			return nil, err
+		}
+
+		in := []reflect.Value{rv}
+		for i := 1; i < mt.NumIn(); i++ {
+			pt := mt.In(i)
+			if mt.IsVariadic() && i == mt.NumIn()-1 {
+				for j := i - 1; j < len(args); j++ {
+					arg, err := v.wrapArg(args[j], pt.Elem())
+					if err != nil {
+						return nil, fmt.Errorf("%s: argument %d: %v", method.Name, j+1, err)
+					}
+					in = append(in, arg)
+				}
+				break
+			}
+			if i-1 >= len(args) {
+				in = append(in, reflect.Zero(pt))
+				continue
+			}
+			arg, err := v.wrapArg(args[i-1], pt)
+			if err != nil {
+				return nil, fmt.Errorf("%s: argument %d: %v", method.Name, i, err)
+			}
+			in = append(in, arg)
+		}
+
+		out := method.Func.Call(in)
+		if n := len(out); n > 0 && mt.Out(n-1) == errorType {
+			if !out[n-1].IsNil() {
+				return nil, out[n-1].Interface().(error)
+			}
+			out = out[:n-1]
+		}
+		switch len(out) {
+		case 0:
+			return nil, nil
+		case 1:
+			res, err := v.wrapResult(out[0])
+			if err != nil {
+				return nil, err
+			}
+			return v.releaseLater(res), nil
+		}
+		items := make([]*Value, 0, len(out))
+		defer func() { v.releaseValues(items...) }()
+		for _, rv := range out {
+			item, err := v.wrapResult(rv)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		res, err := v.toJS(items)
+		if err != nil {
+			return nil, err
+		}
+		return v.releaseLater(res), nil
+	}
+}
+
+// wrapResult converts a Go value read from a wrapped object to JS, wrapping
+// structs and pointers to structs.
+func (v *V8Context) wrapResult(rv reflect.Value) (*Value, error) {
+	t := rv.Type()
+	switch {
+	case t.Kind() == reflect.Struct && rv.CanAddr() && !reflect.PtrTo(t).Implements(jsonMarshalerType):
+		return v.wrap(rv.Addr())
+	case t.Kind() == reflect.Ptr && t.Elem().Kind() == reflect.Struct && !rv.IsNil() &&
+		!t.Implements(jsonMarshalerType):
+		return v.wrap(rv)
+	}
+	return v.ToValue(rv.Interface())
+}
+
+// wrapArg converts a JS value passed to a wrapped object to a Go value of
+// type t.  Wrappers convert back to the Go values they stand for.
+func (v *V8Context) wrapArg(val *Value, t reflect.Type) (reflect.Value, error) {
+	return v.fromJS(val, t)
+}
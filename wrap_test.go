@@ -0,0 +1,134 @@
+package v8
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type wrapAddress struct {
+	City string `json:"city"`
+}
+
+type wrapPerson struct {
+	Name    string
+	Age     int    `js:"age"`
+	Secret  string `js:"-"`
+	Address wrapAddress
+	Friend  *wrapPerson
+	Tags    []string
+}
+
+func (p *wrapPerson) Greet(greeting string) string {
+	return greeting + ", " + p.Name
+}
+
+func (p *wrapPerson) Birthday() {
+	p.Age++
+}
+
+func (p *wrapPerson) Fail(msg string) error {
+	return errors.New(msg)
+}
+
+func (p *wrapPerson) Befriend(other *wrapPerson) {
+	p.Friend = other
+}
+
+func (p *wrapPerson) Split() (string, int, error) {
+	return p.Name, p.Age, nil
+}
+
+func wrapGlobal(t *testing.T, ctx *V8Context, name string, obj interface{}) {
+	val, err := ctx.Wrap(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ctx.SetGlobal(name, val); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWrapFields(t *testing.T) {
+	ctx := NewContext()
+	p := &wrapPerson{Name: "Ann", Age: 30, Secret: "x", Address: wrapAddress{"Oslo"}}
+	wrapGlobal(t, ctx, "p", p)
+
+	res, err := ctx.Eval(`[p.Name, p.age, typeof p.Secret, p.Address.city]`, NO_FILE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []interface{}{"Ann", 30.0, "undefined", "Oslo"}; !reflect.DeepEqual(res, expected) {
+		t.Errorf("Expected %v, got %v", expected, res)
+	}
+
+	// JS writes reach the Go struct, including nested structs.
+	if _, err := ctx.Eval(`p.Name = "Bob"; p.age = 31; p.Address.city = "Rome"; p.Tags = ["a"]`, NO_FILE); err != nil {
+		t.Fatal(err)
+	}
+	if p.Name != "Bob" || p.Age != 31 || p.Address.City != "Rome" || len(p.Tags) != 1 {
+		t.Errorf("JS writes were lost: %#v", p)
+	}
+
+	// Go writes are visible from JS.
+	p.Name = "Cid"
+	if res, err := ctx.Eval(`p.Name`, NO_FILE); err != nil || res != "Cid" {
+		t.Errorf("Expected Cid, got %v (err: %v)", res, err)
+	}
+}
+
+func TestWrapMethods(t *testing.T) {
+	ctx := NewContext()
+	p := &wrapPerson{Name: "Ann", Age: 30}
+	q := &wrapPerson{Name: "Bob"}
+	wrapGlobal(t, ctx, "p", p)
+	wrapGlobal(t, ctx, "q", q)
+
+	if res, err := ctx.Eval(`p.Birthday(); p.Greet("Hi")`, NO_FILE); err != nil || res != "Hi, Ann" {
+		t.Errorf("Expected a greeting, got %v (err: %v)", res, err)
+	}
+	if p.Age != 31 {
+		t.Errorf("Expected Birthday to update the Go struct, age is %d", p.Age)
+	}
+
+	// Wrapped arguments are passed as the Go values they stand for.
+	if _, err := ctx.Eval(`p.Befriend(q)`, NO_FILE); err != nil {
+		t.Fatal(err)
+	}
+	if p.Friend != q {
+		t.Errorf("Expected p.Friend to be q, got %#v", p.Friend)
+	}
+	if res, err := ctx.Eval(`p.Friend.Name`, NO_FILE); err != nil || res != "Bob" {
+		t.Errorf("Expected Bob, got %v (err: %v)", res, err)
+	}
+
+	// Several results come back as an array.
+	if res, err := ctx.Eval(`p.Split()`, NO_FILE); err != nil || !reflect.DeepEqual(res, []interface{}{"Ann", 31.0}) {
+		t.Errorf("Expected [Ann 31], got %v (err: %v)", res, err)
+	}
+
+	_, err := ctx.Eval(`p.Fail("nope")`, NO_FILE)
+	if err == nil || !strings.Contains(err.Error(), "nope") {
+		t.Errorf("Expected the method error to be thrown, got %v", err)
+	}
+}
+
+func TestWrapIllegalInvocation(t *testing.T) {
+	ctx := NewContext()
+	wrapGlobal(t, ctx, "p", &wrapPerson{Name: "Ann"})
+
+	_, err := ctx.Eval(`p.Greet.call({}, "Hi")`, NO_FILE)
+	if err == nil || !strings.Contains(err.Error(), "Illegal invocation") {
+		t.Errorf("Expected an illegal invocation error, got %v", err)
+	}
+}
+
+func TestWrapRejectsNonStructs(t *testing.T) {
+	ctx := NewContext()
+	for _, obj := range []interface{}{nil, 3, wrapPerson{}, (*wrapPerson)(nil)} {
+		if _, err := ctx.Wrap(obj); err == nil {
+			t.Errorf("Expected an error wrapping %#v", obj)
+		}
+	}
+}